@@ -21,7 +21,9 @@ We truncate at 63 chars because some Kubernetes name fields are limited to this
 {{- end -}}
 
 {{- define "imagename" -}}
-{{- if eq .Values.image.tag "" -}}
+{{- if .Values.image.digest -}}
+{{- printf "%s@%s" .Values.image.repository .Values.image.digest -}}
+{{- else if eq .Values.image.tag "" -}}
 {{- .Values.image.repository -}}
 {{- else -}}
 {{- printf "%s:%s" .Values.image.repository .Values.image.tag -}}
@@ -39,9 +41,13 @@ Templates for worker
 
 {{- define "workerimagename" -}}
 {{- if hasKey .worker "image" -}}
-{{-   if and (hasKey .worker.image "repository") (hasKey .worker.image "tag") -}}
+{{-   if and (hasKey .worker.image "repository") .worker.image.digest -}}
+{{- printf "%s@%s" .worker.image.repository .worker.image.digest -}}
+{{-   else if and (hasKey .worker.image "repository") (hasKey .worker.image "tag") -}}
 {{- printf "%s:%s" .worker.image.repository .worker.image.tag -}}
 {{-   end -}}
+{{- else if .glob.image.digest -}}
+{{- printf "%s@%s" .glob.image.repository .glob.image.digest -}}
 {{- else -}}
 {{- printf "%s:%s" .glob.image.repository .glob.image.tag -}}
 {{- end -}}
@@ -63,9 +69,13 @@ Templates for cronjob
 
 {{- define "cronjobimagename" -}}
 {{- if hasKey .job "image" -}}
-{{-   if and (hasKey .job.image "repository") (hasKey .job.image "tag") -}}
+{{-   if and (hasKey .job.image "repository") .job.image.digest -}}
+{{- printf "%s@%s" .job.image.repository .job.image.digest -}}
+{{-   else if and (hasKey .job.image "repository") (hasKey .job.image "tag") -}}
 {{- printf "%s:%s" .job.image.repository .job.image.tag -}}
 {{-   end -}}
+{{- else if .glob.image.digest -}}
+{{- printf "%s@%s" .glob.image.repository .glob.image.digest -}}
 {{- else -}}
 {{- printf "%s:%s" .glob.image.repository .glob.image.tag -}}
 {{- end -}}
@@ -78,6 +88,59 @@ Get a hostname from URL
 {{- . | trimPrefix "http://" |  trimPrefix "https://" | trimSuffix "/" | trim | quote -}}
 {{- end -}}
 
+{{/*
+Get a hostname from an additional host, which is either a plain hostname or a map with a `host` key
+*/}}
+{{- define "additionalhostname" -}}
+{{- if kindIs "map" . -}}
+{{- .host -}}
+{{- else -}}
+{{- . -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Render an Ingress backend pointing at the given service port, which is either a port number or a port name
+*/}}
+{{- define "ingress.backend" -}}
+{{- if .context.Capabilities.APIVersions.Has "networking.k8s.io/v1/Ingress" -}}
+service:
+  name: {{ template "fullname" .context }}
+  port:
+{{- if kindIs "string" .port }}
+    name: {{ .port | quote }}
+{{- else }}
+    number: {{ .port }}
+{{- end }}
+{{- else -}}
+serviceName: {{ template "fullname" .context }}
+servicePort: {{ .port }}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Render the Ingress paths defined in `ingress.extraPaths`. A named `servicePort` must match
+`service.name` or the name of one of `service.extraPorts`.
+*/}}
+{{- define "ingress.extrapaths" -}}
+{{- $portNames := list .Values.service.name -}}
+{{- range $servicePort := .Values.service.extraPorts }}
+{{- $portNames = append $portNames $servicePort.name -}}
+{{- end }}
+{{- range $extraPath := .Values.ingress.extraPaths }}
+{{- $port := $extraPath.servicePort | default $.Values.service.externalPort }}
+{{- if and (kindIs "string" $port) (not (has $port $portNames)) }}
+{{- fail (printf "ingress.extraPaths: service port %q for path %q is not defined in service.extraPorts" $port $extraPath.path) }}
+{{- end }}
+- path: {{ required "ingress.extraPaths: path is required" $extraPath.path | quote }}
+  {{- if $.Capabilities.APIVersions.Has "networking.k8s.io/v1/Ingress" }}
+  pathType: {{ $extraPath.pathType | default "Prefix" }}
+  {{- end }}
+  backend:
+{{- include "ingress.backend" (dict "context" $ "port" $port) | nindent 4 }}
+{{- end }}
+{{- end -}}
+
 {{/*
 Get SecRule's arguments with unescaped single&double quotes
 */}}
@@ -87,6 +150,347 @@ Get SecRule's arguments with unescaped single&double quotes
 {{- printf "SecRule %s %s %s" .variable $operator $action -}}
 {{- end -}}
 
+{{/*
+Get a SecAction with unescaped single&double quotes
+*/}}
+{{- define "secaction" -}}
+{{- printf "SecAction %s" (. | quote | replace "\"" "\\\"" | replace "'" "\\'") -}}
+{{- end -}}
+
+{{/*
+Escape single&double quotes of ModSecurity rules loaded from a file
+*/}}
+{{- define "modsecurity.rules" -}}
+{{- . | replace "\"" "\\\"" | replace "'" "\\'" | trim -}}
+{{- end -}}
+
+{{/*
+Get the name of the Secret synced by the ExternalSecret
+*/}}
+{{- define "externalsecret.secretname" -}}
+{{- .Values.externalSecret.secretName | default (printf "%s-external" (include "fullname" .)) -}}
+{{- end -}}
+
+{{/*
+Get the name of the Secret synced by the SecretProviderClass
+*/}}
+{{- define "secretproviderclass.secretname" -}}
+{{- .Values.secretProviderClass.secretName | default (printf "%s-csi" (include "fullname" .)) -}}
+{{- end -}}
+
+{{/*
+Get the names of the ConfigMaps rendered from configMap.data and configMap.files
+*/}}
+{{- define "configmap.name" -}}
+{{- printf "%s-config" (include "fullname" .) -}}
+{{- end -}}
+
+{{- define "configmap.filesname" -}}
+{{- printf "%s-config-files" (include "fullname" .) -}}
+{{- end -}}
+
+{{/*
+Get the key of a configMap.files entry, unique even when files share a base name
+*/}}
+{{- define "configmap.filekey" -}}
+{{- printf "%d-%s" .index (base .path) -}}
+{{- end -}}
+
+{{/*
+Get the envFrom entry of the ConfigMap rendered from configMap.data
+*/}}
+{{- define "application.configmapref" -}}
+{{- if .Values.configMap.data }}
+- configMapRef:
+    name: {{ template "configmap.name" . }}
+{{- end }}
+{{- end -}}
+
+{{/*
+Get the envFrom entries of the Secrets loaded next to application.secretName.
+Hook jobs load the Secrets synced by the ExternalSecret and the SecretProviderClass
+as optional, as they are only synced after the upgrade that enables them.
+
+Usage:
+{{ include "application.secretrefs" (dict "context" . "hook" false) }}
+*/}}
+{{- define "application.secretrefs" -}}
+{{- $values := .context.Values -}}
+{{- range $secret := $values.application.extraSecrets }}
+{{-   if not $secret.mountPath }}
+- secretRef:
+    name: {{ $secret.secretName }}
+{{-   end }}
+{{- end }}
+{{- if $values.externalSecret.enabled }}
+- secretRef:
+    name: {{ template "externalsecret.secretname" .context }}
+{{-   if .hook }}
+    optional: true
+{{-   end }}
+{{- end }}
+{{- if and $values.secretProviderClass.enabled $values.secretProviderClass.secretData }}
+- secretRef:
+    name: {{ template "secretproviderclass.secretname" .context }}
+{{-   if .hook }}
+    optional: true
+{{-   end }}
+{{- end }}
+{{- end -}}
+
+{{- define "application.extrasecretrefs" -}}
+{{- include "application.secretrefs" (dict "context" . "hook" false) -}}
+{{- end -}}
+
+{{- define "application.hookextrasecretrefs" -}}
+{{- include "application.secretrefs" (dict "context" . "hook" true) -}}
+{{- end -}}
+
+{{/*
+Get the annotation restarting pods when a synced Secret is rotated
+*/}}
+{{- define "application.secretrotationannotation" -}}
+{{- if .Values.secretRotation.enabled }}
+{{-   $names := list }}
+{{-   if .Values.externalSecret.enabled }}
+{{-     $names = append $names (include "externalsecret.secretname" .) }}
+{{-   end }}
+{{-   if and .Values.secretProviderClass.enabled .Values.secretProviderClass.secretData }}
+{{-     $names = append $names (include "secretproviderclass.secretname" .) }}
+{{-   end }}
+{{-   if $names }}
+{{ .Values.secretRotation.annotation }}: {{ join "," $names | quote }}
+{{-   end }}
+{{- end }}
+{{- end -}}
+
+{{/*
+Get the volumes of the Secrets and ConfigMaps mounted as files, including the
+SecretProviderClass CSI volume. Hook jobs run before the release ConfigMaps are
+updated, so they read configMap.files from the annotations of their pod, see
+application.hookconfigannotations.
+
+Usage:
+{{ include "application.podvolumes" (dict "context" . "hook" false) }}
+*/}}
+{{- define "application.podvolumes" -}}
+{{- $ctx := .context -}}
+{{- range $index, $secret := $ctx.Values.application.extraSecrets }}
+{{-   if $secret.mountPath }}
+- name: extra-secret-{{ $index }}
+  secret:
+    secretName: {{ $secret.secretName }}
+{{-   end }}
+{{- end }}
+{{- if and $ctx.Values.configMap.files .hook }}
+- name: config-files
+  downwardAPI:
+    items:
+{{-   range $index, $file := $ctx.Values.configMap.files }}
+    - path: {{ include "configmap.filekey" (dict "index" $index "path" $file.path) }}
+      fieldRef:
+        fieldPath: metadata.annotations['app.gitlab.com/config-file-{{ $index }}']
+{{-   end }}
+{{- else if $ctx.Values.configMap.files }}
+- name: config-files
+  configMap:
+    name: {{ template "configmap.filesname" $ctx }}
+{{- end }}
+{{- if $ctx.Values.secretProviderClass.enabled }}
+- name: secrets-store
+  csi:
+    driver: secrets-store.csi.k8s.io
+    readOnly: true
+    volumeAttributes:
+      secretProviderClass: {{ template "fullname" $ctx }}
+{{- end }}
+{{- end -}}
+
+{{- define "application.volumes" -}}
+{{- include "application.podvolumes" (dict "context" . "hook" false) -}}
+{{- end -}}
+
+{{- define "application.hookvolumes" -}}
+{{- include "application.podvolumes" (dict "context" . "hook" true) -}}
+{{- end -}}
+
+{{/*
+Get the mounts of the volumes from application.podvolumes
+*/}}
+{{- define "application.podvolumemounts" -}}
+{{- $ctx := .context -}}
+{{- range $index, $secret := $ctx.Values.application.extraSecrets }}
+{{-   if $secret.mountPath }}
+- name: extra-secret-{{ $index }}
+  mountPath: {{ $secret.mountPath | quote }}
+  readOnly: true
+{{-   end }}
+{{- end }}
+{{- range $index, $file := $ctx.Values.configMap.files }}
+- name: config-files
+  mountPath: {{ $file.path | quote }}
+  subPath: {{ include "configmap.filekey" (dict "index" $index "path" $file.path) }}
+  readOnly: true
+{{- end }}
+{{- if $ctx.Values.secretProviderClass.enabled }}
+- name: secrets-store
+  mountPath: {{ $ctx.Values.secretProviderClass.mountPath | quote }}
+  readOnly: true
+{{- end }}
+{{- end -}}
+
+{{- define "application.volumemounts" -}}
+{{- include "application.podvolumemounts" (dict "context" . "hook" false) -}}
+{{- end -}}
+
+{{- define "application.hookvolumemounts" -}}
+{{- include "application.podvolumemounts" (dict "context" . "hook" true) -}}
+{{- end -}}
+
+{{/*
+Get the environment variables of configMap.data for hook jobs, which cannot
+load the release ConfigMap as it is created after the pre-upgrade hooks
+*/}}
+{{- define "application.hookconfigenv" -}}
+{{- range $key, $value := .Values.configMap.data }}
+- name: {{ $key }}
+  value: {{ $value | toString | quote }}
+{{- end }}
+{{- end -}}
+
+{{/*
+Get the pod annotations holding configMap.files for hook jobs, mounted with
+the downward API by application.hookvolumes
+*/}}
+{{- define "application.hookconfigannotations" -}}
+{{- range $index, $file := .Values.configMap.files }}
+app.gitlab.com/config-file-{{ $index }}: {{ $file.content | quote }}
+{{- end }}
+{{- end -}}
+
+{{/*
+Get the name of the managed database resource. Crossplane resources keep the
+application name, so that existing instances are not provisioned again. The
+CloudNativePG Cluster is named after the fullname of the release rendering it.
+*/}}
+{{- define "postgresql.managed.name" -}}
+{{- if eq .Values.postgresql.managedProvider "cloudnativepg" -}}
+{{- $release := .Values.postgresql.cloudnativepg.clusterRelease | default .Release.Name -}}
+{{- $name := default .Chart.Name .Values.nameOverride -}}
+{{- printf "%s-%s" $release $name | trimSuffix "-app" | trunc 63 | trimSuffix "-" | printf "%s-postgres" -}}
+{{- else if eq .Values.postgresql.managedProvider "crossplane" -}}
+{{- template "appname" . -}}
+{{- else -}}
+{{- fail (printf "postgresql.managedProvider must be one of crossplane or cloudnativepg, got %q" .Values.postgresql.managedProvider) -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Get the name of the Secret holding the managed database credentials. The legacy
+Crossplane PostgreSQLInstance keeps writing to app-postgres, so that existing
+instances do not need to write a new Secret.
+*/}}
+{{- define "postgresql.managed.secretname" -}}
+{{- $name := include "postgresql.managed.name" . -}}
+{{- if eq .Values.postgresql.managedProvider "cloudnativepg" -}}
+{{- printf "%s-app" $name -}}
+{{- else if .Values.postgresql.managedSecretName -}}
+{{- .Values.postgresql.managedSecretName -}}
+{{- else if eq .Values.postgresql.crossplane.apiVersion "database.crossplane.io/v1alpha1" -}}
+app-postgres
+{{- else -}}
+{{- printf "%s-postgres" (include "fullname" .) -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Get the engine version of the managed database
+*/}}
+{{- define "postgresql.managed.engineversion" -}}
+{{- if .Values.postgresql.managedEngineVersion -}}
+{{- .Values.postgresql.managedEngineVersion | toString -}}
+{{- else if eq .Values.postgresql.managedProvider "cloudnativepg" -}}
+16
+{{- else -}}
+9.6
+{{- end -}}
+{{- end -}}
+
+{{/*
+Get the POSTGRES_* environment variables read from the managed database Secret
+*/}}
+{{- define "postgresql.managed.env" -}}
+{{- $secretName := include "postgresql.managed.secretname" . }}
+{{- $keys := .Values.postgresql.crossplane.secretKeys }}
+{{- if eq .Values.postgresql.managedProvider "cloudnativepg" }}
+{{-   $keys = dict "POSTGRES_USER" "username" "POSTGRES_PASSWORD" "password" "POSTGRES_HOST" "host" "POSTGRES_PORT" "port" "POSTGRES_DB" "dbname" }}
+{{- end }}
+{{- range $name := list "POSTGRES_USER" "POSTGRES_PASSWORD" "POSTGRES_HOST" "POSTGRES_PORT" "POSTGRES_DB" }}
+{{-   if hasKey $keys $name }}
+- name: {{ $name }}
+  valueFrom:
+    secretKeyRef:
+      name: {{ $secretName }}
+      key: {{ get $keys $name }}
+{{-   end }}
+{{- end }}
+{{- end -}}
+
+{{/*
+Get the DATABASE_URL environment variable. Without an explicit URL, it is read
+from the Secret generated by CloudNativePG.
+*/}}
+{{- define "application.databaseurlenv" -}}
+{{- if .Values.application.database_url }}
+- name: DATABASE_URL
+  value: {{ .Values.application.database_url | quote }}
+{{- else if and .Values.postgresql.managed (eq .Values.postgresql.managedProvider "cloudnativepg") }}
+- name: DATABASE_URL
+  valueFrom:
+    secretKeyRef:
+      name: {{ include "postgresql.managed.secretname" . }}
+      key: uri
+{{- end }}
+{{- end -}}
+
+{{/*
+Get the name of the claim the database backups are written to
+*/}}
+{{- define "databasebackup.claimname" -}}
+{{- .Values.databaseBackup.pvc.existingClaim | default (printf "%s-db-backup" (include "fullname" .)) -}}
+{{- end -}}
+
+{{/*
+Check whether the database is backed up before migrations. Review apps are
+skipped unless configured otherwise. A claim created by the chart only exists
+once the release is installed, so the backup waits for databaseBackup.pvc.claimCreated
+to avoid blocking the upgrade that enables backups.
+*/}}
+{{- define "databasebackup.enabled" -}}
+{{- $backup := .Values.databaseBackup -}}
+{{- if and $backup.enabled .Values.application.migrateCommand (not (and $backup.skipForReviewApps (hasPrefix "review/" (toString .Values.gitlab.envName)))) -}}
+{{- if or (ne $backup.destination "pvc") $backup.pvc.existingClaim $backup.pvc.claimCreated -}}
+true
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Get the environment of the database backup container, DATABASE_URL is read
+from the application secret or the chart values
+*/}}
+{{- define "databasebackup.env" -}}
+{{- with .Values.application.secretName }}
+envFrom:
+- secretRef:
+    name: {{ . }}
+{{- end }}
+{{- with include "application.databaseurlenv" . }}
+env:
+{{- . | trim | nindent 0 }}
+{{- end }}
+{{- end -}}
+
 {{/*
 Generate a name for a Persistent Volume Claim
 */}}
@@ -115,11 +519,60 @@ app.kubernetes.io/instance: {{ .Release.Name }}
 {{- $merged | toYaml -}}
 {{- end -}}
 
+{{/*
+Get the name of the htpasswd Secret used by `ingress.basicAuth`
+*/}}
+{{- define "ingress.basicAuthSecretName" -}}
+{{- if .Values.ingress.basicAuth.secretName -}}
+{{- .Values.ingress.basicAuth.secretName -}}
+{{- else if .Values.ingress.basicAuth.htpasswd -}}
+{{- printf "%s-basic-auth" (include "fullname" .) -}}
+{{- else -}}
+{{- fail "ingress.basicAuth requires either secretName or htpasswd to be set" -}}
+{{- end -}}
+{{- end -}}
+
 {{- define "appurls" -}}
 {{ printf "%s%s" .Values.service.url .Values.ingress.path }}
+{{- if .Values.service.commonName }}
+{{ if .Values.ingress.tls.enabled }}https://{{ else }}http://{{ end }}{{ printf "%s%s" .Values.service.commonName .Values.ingress.path }}
+{{- end }}
 {{- if .Values.service.additionalHosts }}
 {{- range $host := .Values.service.additionalHosts }}
-{{ if $.Values.ingress.tls.enabled }}https://{{ else }}http://{{ end }}{{ printf "%s%s" $host $.Values.ingress.path }}
+{{- $path := $.Values.ingress.path }}
+{{- if kindIs "map" $host }}
+{{- $path = $host.path | default $.Values.ingress.path }}
+{{- end }}
+{{ if $.Values.ingress.tls.enabled }}https://{{ else }}http://{{ end }}{{ printf "%s%s" (include "additionalhostname" $host) $path }}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Resources of a container. Explicit resources take precedence over a preset, and those of
+a worker or cron job (passed as "resources" and "preset") over the top-level ones.
+*/}}
+{{- define "resources" -}}
+{{- $values := .context.Values -}}
+{{- $own := .resources | default dict -}}
+{{- $global := $values.resources | default dict -}}
+{{- if or $own.limits $own.requests -}}
+{{- toYaml $own -}}
+{{- else if .preset -}}
+{{- include "resourcespreset" (dict "preset" .preset "context" .context) -}}
+{{- else if or $global.limits $global.requests -}}
+{{- toYaml $global -}}
+{{- else if $values.resourcesPreset -}}
+{{- include "resourcespreset" (dict "preset" $values.resourcesPreset "context" .context) -}}
+{{- else -}}
+{{- toYaml $values.resources -}}
 {{- end -}}
 {{- end -}}
+
+{{- define "resourcespreset" -}}
+{{- $presets := .context.Values.resourcesPresets | default dict -}}
+{{- if not (hasKey $presets .preset) -}}
+{{- fail (printf "resourcesPreset must be one of %s, got %q" (keys $presets | sortAlpha | join ", ") .preset) -}}
+{{- end -}}
+{{- toYaml (index $presets .preset) -}}
 {{- end -}}
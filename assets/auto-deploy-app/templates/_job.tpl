@@ -0,0 +1,140 @@
+{{/*
+Render a Job hook running a shell command in the application image, with the
+same secrets, config and environment as the application. Secrets synced by the
+ExternalSecret and the SecretProviderClass are left out, as hooks run before
+they are created, and configMap is read from the values instead of the release
+ConfigMaps. Pod and job settings of `config` fall back to the top-level values.
+
+Usage:
+{{ include "application.job" (dict "context" . "name" "db-migrate" "hook" "pre-upgrade" "weight" 0 "command" .Values.application.migrateCommand "config" .Values.application.migrate) }}
+*/}}
+{{- define "application.job" -}}
+{{- $ctx := .context -}}
+{{- $values := $ctx.Values -}}
+{{- $config := .config | default dict -}}
+{{- $nodeSelector := $config.nodeSelector | default $values.nodeSelector -}}
+{{- $tolerations := $config.tolerations | default $values.tolerations -}}
+{{- $affinity := $config.affinity | default $values.affinity -}}
+{{- $securityContext := $config.securityContext | default $values.securityContext -}}
+{{- $containerSecurityContext := $config.containerSecurityContext | default $values.containerSecurityContext -}}
+{{- $resources := $config.resources | default $values.resources -}}
+{{- $extraVolumes := $config.extraVolumes | default $values.extraVolumes -}}
+{{- $extraVolumeMounts := $config.extraVolumeMounts | default $values.extraVolumeMounts -}}
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{ template "trackableappname" $ctx }}-{{ .name }}
+  labels:
+{{ include "sharedlabels" $ctx | indent 4 }}
+  annotations:
+    "helm.sh/hook": {{ .hook }}
+    "helm.sh/hook-delete-policy": {{ .deletePolicy | default "before-hook-creation" }}
+    "helm.sh/hook-weight": {{ .weight | default 0 | quote }}
+spec:
+  {{- if not (kindIs "invalid" $config.backoffLimit) }}
+  backoffLimit: {{ $config.backoffLimit }}
+  {{- end }}
+  {{- with $config.activeDeadlineSeconds }}
+  activeDeadlineSeconds: {{ . }}
+  {{- end }}
+  {{- if not (kindIs "invalid" $config.ttlSecondsAfterFinished) }}
+  ttlSecondsAfterFinished: {{ $config.ttlSecondsAfterFinished }}
+  {{- end }}
+  template:
+    metadata:
+      labels:
+{{ include "sharedlabels" $ctx | indent 8 }}
+      {{- with include "application.hookconfigannotations" $ctx }}
+      annotations:
+      {{- . | trim | nindent 8 }}
+      {{- end }}
+    spec:
+      restartPolicy: {{ $config.restartPolicy | default "Never" }}
+      {{- with $values.image.secrets }}
+      imagePullSecrets:
+      {{- toYaml . | nindent 6 }}
+      {{- end }}
+      {{- with $nodeSelector }}
+      nodeSelector:
+      {{- toYaml . | nindent 8 }}
+      {{- end }}
+      {{- with $tolerations }}
+      tolerations:
+      {{- toYaml . | nindent 6 }}
+      {{- end }}
+      {{- with $affinity }}
+      affinity:
+      {{- toYaml . | nindent 8 }}
+      {{- end }}
+      {{- with $securityContext }}
+      securityContext:
+      {{- toYaml . | nindent 8 }}
+      {{- end }}
+      {{- if or $extraVolumes (include "application.hookvolumes" $ctx) }}
+      volumes:
+      {{- with $extraVolumes }}
+      {{- toYaml . | nindent 6 }}
+      {{- end }}
+      {{- with include "application.hookvolumes" $ctx }}
+      {{- . | trim | nindent 6 }}
+      {{- end }}
+      {{- end }}
+      containers:
+      - name: {{ $ctx.Chart.Name }}
+        image: {{ template "imagename" $ctx }}
+        {{- with $config.command }}
+        command: {{ toJson . }}
+        args: [{{ $.command | quote }}]
+        {{- else }}
+        command: ["/bin/sh"]
+        args: ["-c", "{{ .command }}"]
+        {{- end }}
+        imagePullPolicy: {{ $values.image.pullPolicy }}
+        {{- if $values.application.secretName }}
+        envFrom:
+        - secretRef:
+            name: {{ $values.application.secretName }}
+{{- with include "application.hookextrasecretrefs" $ctx }}
+{{- . | trim | nindent 8 }}
+{{- end }}
+{{- if $values.extraEnvFrom }}
+{{- tpl ($values.extraEnvFrom | toYaml) $ctx | nindent 8 }}
+{{- end }}
+        {{- else if include "application.hookextrasecretrefs" $ctx }}
+        envFrom:
+{{- with include "application.hookextrasecretrefs" $ctx }}
+{{- . | trim | nindent 8 }}
+{{- end }}
+        {{- end }}
+        env:
+{{- with include "application.hookconfigenv" $ctx }}
+{{- . | trim | nindent 8 }}
+{{- end }}
+{{- with include "application.databaseurlenv" $ctx }}
+{{- . | trim | nindent 8 }}
+{{- end }}
+{{- if $values.extraEnv }}
+{{- toYaml $values.extraEnv | nindent 8 }}
+{{- end }}
+        - name: GITLAB_ENVIRONMENT_NAME
+          value: {{ $values.gitlab.envName | quote }}
+        - name: GITLAB_ENVIRONMENT_URL
+          value: {{ $values.gitlab.envURL | quote }}
+        {{- with $containerSecurityContext }}
+        securityContext:
+        {{- toYaml . | nindent 10 }}
+        {{- end }}
+        {{- with $resources }}
+        resources:
+        {{- toYaml . | nindent 10 }}
+        {{- end }}
+        {{- if or $extraVolumeMounts (include "application.hookvolumemounts" $ctx) }}
+        volumeMounts:
+        {{- with $extraVolumeMounts }}
+        {{- toYaml . | nindent 8 }}
+        {{- end }}
+        {{- with include "application.hookvolumemounts" $ctx }}
+        {{- . | trim | nindent 8 }}
+        {{- end }}
+        {{- end }}
+{{- end -}}
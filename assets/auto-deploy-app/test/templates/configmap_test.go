@@ -0,0 +1,82 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+	coreV1 "k8s.io/api/core/v1"
+)
+
+func TestConfigMapTemplate(t *testing.T) {
+	templates := []string{"templates/configmap.yaml"}
+	releaseName := "configmap-test"
+
+	tcs := []struct {
+		name       string
+		valueFiles []string
+		values     map[string]string
+
+		expectedConfigMaps  map[string]map[string]string
+		expectedErrorRegexp *regexp.Regexp
+	}{
+		{
+			name:                "defaults",
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/configmap.yaml in chart"),
+		},
+		{
+			name:       "with data and files",
+			valueFiles: []string{"../testdata/configmap.yaml"},
+			expectedConfigMaps: map[string]map[string]string{
+				releaseName + "-auto-deploy-config": {
+					"LOG_LEVEL":    "info",
+					"WORKER_COUNT": "4",
+				},
+				releaseName + "-auto-deploy-config-files": {
+					"0-settings.yaml": "key: value",
+					"1-settings.yaml": "other: value",
+				},
+			},
+		},
+		{
+			name: "with data only",
+			values: map[string]string{
+				"configMap.data.LOG_LEVEL": "debug",
+			},
+			expectedConfigMaps: map[string]map[string]string{
+				releaseName + "-auto-deploy-config": {
+					"LOG_LEVEL": "debug",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &helm.Options{
+				ValuesFiles: tc.valueFiles,
+				SetValues:   tc.values,
+			}
+			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp)
+
+			if tc.expectedErrorRegexp != nil {
+				return
+			}
+
+			configMaps := map[string]map[string]string{}
+			for _, document := range strings.Split(output, "---")[1:] {
+				configMap := new(coreV1.ConfigMap)
+				helm.UnmarshalK8SYaml(t, document, configMap)
+				// Release resources, so that rollbacks restore them and uninstalls delete them
+				require.NotContains(t, configMap.ObjectMeta.Annotations, "helm.sh/hook")
+				for key, value := range configMap.Data {
+					configMap.Data[key] = strings.TrimSpace(value)
+				}
+				configMaps[configMap.ObjectMeta.Name] = configMap.Data
+			}
+			require.Equal(t, tc.expectedConfigMaps, configMaps)
+		})
+	}
+}
@@ -202,6 +202,32 @@ func TestCronjobImage(t *testing.T) {
 			},
 			ExpectedImage: "alpine:latest",
 		},
+		{
+			CaseName: "default image digest",
+			Release:  "production",
+			Values: map[string]string{
+				"cronjobs.job1.command[0]": "echo",
+				"cronjobs.job2.args[0]":    "hello",
+				"image.digest":             "sha256:0123456789abcdef",
+			},
+			ExpectedImage: "gitlab.example.com/group/project@sha256:0123456789abcdef",
+		},
+		{
+			CaseName: "alpine image digest",
+			Release:  "production",
+			Values: map[string]string{
+				"image.digest": "sha256:0123456789abcdef",
+
+				"cronjobs.job1.image.repository": "alpine",
+				"cronjobs.job1.image.tag":        "latest",
+				"cronjobs.job1.image.digest":     "sha256:fedcba9876543210",
+
+				"cronjobs.job2.image.repository": "alpine",
+				"cronjobs.job2.image.tag":        "latest",
+				"cronjobs.job2.image.digest":     "sha256:fedcba9876543210",
+			},
+			ExpectedImage: "alpine@sha256:fedcba9876543210",
+		},
 	} {
 		t.Run(tc.CaseName, func(t *testing.T) {
 			namespaceName := "minimal-ruby-app-" + strings.ToLower(random.UniqueId())
@@ -555,6 +581,42 @@ func TestCronjobResources(t *testing.T) {
 				},
 			},
 		},
+		{
+			CaseName: "job resources preset",
+			Release:  "production",
+			Values: map[string]string{
+				"cronjobs.job1.command[0]":      "echo",
+				"cronjobs.job1.args[0]":         "hello",
+				"cronjobs.job1.resourcesPreset": "nano",
+				"resourcesPreset":               "large",
+			},
+
+			ExpectedResources: coreV1.ResourceRequirements{
+				Limits: coreV1.ResourceList{
+					"memory": resource.MustParse("128Mi"),
+				},
+				Requests: coreV1.ResourceList{
+					"cpu":    resource.MustParse("10m"),
+					"memory": resource.MustParse("64Mi"),
+				},
+			},
+		},
+		{
+			CaseName: "job resources",
+			Release:  "production",
+			Values: map[string]string{
+				"cronjobs.job1.command[0]":              "echo",
+				"cronjobs.job1.args[0]":                 "hello",
+				"cronjobs.job1.resources.limits.memory": "1Gi",
+				"resourcesPreset":                       "large",
+			},
+
+			ExpectedResources: coreV1.ResourceRequirements{
+				Limits: coreV1.ResourceList{
+					"memory": resource.MustParse("1Gi"),
+				},
+			},
+		},
 	} {
 		t.Run(tc.CaseName, func(t *testing.T) {
 			namespaceName := "minimal-ruby-app-" + strings.ToLower(random.UniqueId())
@@ -850,6 +912,115 @@ func TestCronJobTemplateWithExtraEnvFrom(t *testing.T) {
 	}
 }
 
+func TestCronJobTemplateWithSyncedSecrets(t *testing.T) {
+	releaseName := "cronjob-with-synced-secrets-test"
+	readOnly := true
+	expectedEnvFrom := []coreV1.EnvFromSource{
+		{SecretRef: &coreV1.SecretEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: "gitlab-secretname-test"}}},
+		{SecretRef: &coreV1.SecretEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: releaseName + "-auto-deploy-external"}}},
+		{SecretRef: &coreV1.SecretEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: releaseName + "-auto-deploy-csi"}}},
+	}
+	expectedVolume := coreV1.Volume{
+		Name: "secrets-store",
+		VolumeSource: coreV1.VolumeSource{
+			CSI: &coreV1.CSIVolumeSource{
+				Driver:           "secrets-store.csi.k8s.io",
+				ReadOnly:         &readOnly,
+				VolumeAttributes: map[string]string{"secretProviderClass": releaseName + "-auto-deploy"},
+			},
+		},
+	}
+	expectedVolumeMount := coreV1.VolumeMount{Name: "secrets-store", MountPath: "/mnt/secrets-store", ReadOnly: true}
+
+	options := &helm.Options{
+		ValuesFiles: []string{"../testdata/synced-secrets.yaml"},
+		SetValues: map[string]string{
+			"cronjobs.job1.schedule": "*/2 * * * *",
+		},
+	}
+	output := mustRenderTemplate(t, options, releaseName, []string{"templates/cronjob.yaml"}, nil)
+
+	var cronjobs batchV1beta1.CronJobList
+	helm.UnmarshalK8SYaml(t, output, &cronjobs)
+	require.Len(t, cronjobs.Items, 1)
+	for _, cronjob := range cronjobs.Items {
+		podSpec := cronjob.Spec.JobTemplate.Spec.Template.Spec
+		require.Equal(t, expectedEnvFrom, podSpec.Containers[0].EnvFrom)
+		require.Contains(t, podSpec.Volumes, expectedVolume)
+		require.Contains(t, podSpec.Containers[0].VolumeMounts, expectedVolumeMount)
+	}
+}
+
+func TestCronJobTemplateWithExtraSecrets(t *testing.T) {
+	releaseName := "cronjob-with-extra-secrets-test"
+	expectedEnvFrom := []coreV1.EnvFromSource{
+		{SecretRef: &coreV1.SecretEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: "production-secret"}}},
+		{SecretRef: &coreV1.SecretEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: "production-secret-smtp"}}},
+	}
+	expectedVolumes := []coreV1.Volume{
+		{Name: "extra-secret-0", VolumeSource: coreV1.VolumeSource{Secret: &coreV1.SecretVolumeSource{SecretName: "production-secret-files"}}},
+		{Name: "extra-secret-2", VolumeSource: coreV1.VolumeSource{Secret: &coreV1.SecretVolumeSource{SecretName: "production-secret-tls-api"}}},
+	}
+	expectedVolumeMounts := []coreV1.VolumeMount{
+		{Name: "extra-secret-0", MountPath: "/etc/secrets/files", ReadOnly: true},
+		{Name: "extra-secret-2", MountPath: "/etc/secrets/tls-api", ReadOnly: true},
+	}
+
+	options := &helm.Options{
+		ValuesFiles: []string{"../testdata/extra-secrets.yaml"},
+		SetValues: map[string]string{
+			"cronjobs.job1.schedule": "*/2 * * * *",
+		},
+	}
+	output := mustRenderTemplate(t, options, releaseName, []string{"templates/cronjob.yaml"}, nil)
+
+	var cronjobs batchV1beta1.CronJobList
+	helm.UnmarshalK8SYaml(t, output, &cronjobs)
+	require.Len(t, cronjobs.Items, 1)
+	for _, cronjob := range cronjobs.Items {
+		podSpec := cronjob.Spec.JobTemplate.Spec.Template.Spec
+		require.Equal(t, expectedEnvFrom, podSpec.Containers[0].EnvFrom)
+		require.Equal(t, expectedVolumes, podSpec.Volumes)
+		require.Equal(t, expectedVolumeMounts, podSpec.Containers[0].VolumeMounts)
+	}
+}
+
+func TestCronJobTemplateWithConfigMap(t *testing.T) {
+	releaseName := "cronjob-with-configmap-test"
+	expectedEnvFrom := coreV1.EnvFromSource{
+		ConfigMapRef: &coreV1.ConfigMapEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: releaseName + "-auto-deploy-config"}},
+	}
+	expectedVolume := coreV1.Volume{
+		Name: "config-files",
+		VolumeSource: coreV1.VolumeSource{
+			ConfigMap: &coreV1.ConfigMapVolumeSource{LocalObjectReference: coreV1.LocalObjectReference{Name: releaseName + "-auto-deploy-config-files"}},
+		},
+	}
+	expectedVolumeMounts := []coreV1.VolumeMount{
+		{Name: "config-files", MountPath: "/app/config/settings.yaml", SubPath: "0-settings.yaml", ReadOnly: true},
+		{Name: "config-files", MountPath: "/etc/app/settings.yaml", SubPath: "1-settings.yaml", ReadOnly: true},
+	}
+
+	options := &helm.Options{
+		ValuesFiles: []string{"../testdata/configmap.yaml"},
+		SetValues: map[string]string{
+			"cronjobs.job1.schedule": "*/2 * * * *",
+		},
+	}
+	output := mustRenderTemplate(t, options, releaseName, []string{"templates/cronjob.yaml"}, nil)
+
+	var cronjobs batchV1beta1.CronJobList
+	helm.UnmarshalK8SYaml(t, output, &cronjobs)
+	require.Len(t, cronjobs.Items, 1)
+	for _, cronjob := range cronjobs.Items {
+		podTemplate := cronjob.Spec.JobTemplate.Spec.Template
+		require.Regexp(t, "^[0-9a-f]{64}$", podTemplate.ObjectMeta.Annotations["checksum/application-config"])
+		require.Equal(t, []coreV1.EnvFromSource{expectedEnvFrom}, podTemplate.Spec.Containers[0].EnvFrom)
+		require.Equal(t, []coreV1.Volume{expectedVolume}, podTemplate.Spec.Volumes)
+		require.Equal(t, expectedVolumeMounts, podTemplate.Spec.Containers[0].VolumeMounts)
+	}
+}
+
 func TestCronJobTemplateWithSecurityContext(t *testing.T) {
 	releaseName := "cronjob-with-security-context"
 
@@ -1111,4 +1282,28 @@ func TestCronjobPodAnnotations(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestCronJobTemplateWithManagedPostgres(t *testing.T) {
+	releaseName := "cronjob-managed-postgres-test"
+	secretName := "app-postgres"
+	expectedEnv := []coreV1.EnvVar{
+		secretKeyEnvVar("POSTGRES_USER", secretName, "username"),
+		secretKeyEnvVar("POSTGRES_PASSWORD", secretName, "password"),
+		secretKeyEnvVar("POSTGRES_HOST", secretName, "privateIP"),
+	}
+
+	options := &helm.Options{
+		SetValues: map[string]string{
+			"postgresql.managed":     "true",
+			"cronjobs.job1.schedule": "*/2 * * * *",
+		},
+	}
+	output := mustRenderTemplate(t, options, releaseName, []string{"templates/cronjob.yaml"}, nil)
+
+	var cronjobs batchV1beta1.CronJobList
+	helm.UnmarshalK8SYaml(t, output, &cronjobs)
+	require.Len(t, cronjobs.Items, 1)
+	for _, cronjob := range cronjobs.Items {
+		require.Subset(t, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env, expectedEnv)
+	}
+}
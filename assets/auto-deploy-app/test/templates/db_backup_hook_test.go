@@ -0,0 +1,295 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+	batchV1 "k8s.io/api/batch/v1"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestDatabaseBackupHookTemplate(t *testing.T) {
+	templates := []string{"templates/db-backup-hook.yaml"}
+	releaseName := "db-backup-test"
+	notFound := regexp.MustCompile("Error: could not find template templates/db-backup-hook.yaml in chart")
+
+	tcs := []struct {
+		name   string
+		values map[string]string
+
+		expectedVolumeSource   coreV1.VolumeSource
+		expectedInitContainers []string
+		expectedContainers     []string
+		expectedArgsRegexp     *regexp.Regexp
+		expectedErrorRegexp    *regexp.Regexp
+	}{
+		{
+			name: "with existing claim",
+			values: map[string]string{
+				"databaseBackup.pvc.existingClaim": "backups",
+			},
+			expectedVolumeSource: coreV1.VolumeSource{
+				PersistentVolumeClaim: &coreV1.PersistentVolumeClaimVolumeSource{ClaimName: "backups"},
+			},
+			expectedContainers: []string{"postgres:16-alpine"},
+			expectedArgsRegexp: regexp.MustCompile(`(?s)pg_dump --format=custom --file="/backups/db-backup-test-auto-deploy-.*tail -n \+8 \| xargs -r rm -f`),
+		},
+		{
+			name: "with retention and image",
+			values: map[string]string{
+				"databaseBackup.pvc.existingClaim": "backups",
+				"databaseBackup.retention":         "3",
+				"databaseBackup.image.tag":         "15-alpine",
+			},
+			expectedVolumeSource: coreV1.VolumeSource{
+				PersistentVolumeClaim: &coreV1.PersistentVolumeClaimVolumeSource{ClaimName: "backups"},
+			},
+			expectedContainers: []string{"postgres:15-alpine"},
+			expectedArgsRegexp: regexp.MustCompile(`tail -n \+4 \| xargs -r rm -f`),
+		},
+		{
+			name: "with s3",
+			values: map[string]string{
+				"databaseBackup.destination":    "s3",
+				"databaseBackup.s3.bucket":      "backups",
+				"databaseBackup.s3.prefix":      "production/",
+				"databaseBackup.s3.endpointURL": "https://minio.example.com",
+				"databaseBackup.s3.secretName":  "backup-credentials",
+			},
+			expectedVolumeSource: coreV1.VolumeSource{
+				EmptyDir: &coreV1.EmptyDirVolumeSource{},
+			},
+			expectedInitContainers: []string{"postgres:16-alpine"},
+			expectedContainers:     []string{"amazon/aws-cli:2.15.0"},
+			expectedArgsRegexp:     regexp.MustCompile(`(?s)destination="s3://backups/production/".*--endpoint-url "https://minio.example.com".*tail -n \+8`),
+		},
+		{
+			name: "with s3 and no bucket",
+			values: map[string]string{
+				"databaseBackup.destination":   "s3",
+				"databaseBackup.s3.secretName": "backup-credentials",
+			},
+			expectedErrorRegexp: regexp.MustCompile("databaseBackup.s3.bucket is required for the s3 destination"),
+		},
+		{
+			name: "with unknown destination",
+			values: map[string]string{
+				"databaseBackup.destination": "gcs",
+			},
+			expectedErrorRegexp: regexp.MustCompile(`databaseBackup.destination must be one of pvc or s3, got "gcs"`),
+		},
+		{
+			name: "with claim created by the chart",
+			values: map[string]string{
+				"databaseBackup.pvc.claimCreated": "true",
+			},
+			expectedVolumeSource: coreV1.VolumeSource{
+				PersistentVolumeClaim: &coreV1.PersistentVolumeClaimVolumeSource{ClaimName: releaseName + "-auto-deploy-db-backup"},
+			},
+			expectedContainers: []string{"postgres:16-alpine"},
+			expectedArgsRegexp: regexp.MustCompile(`pg_dump`),
+		},
+		{
+			name: "with claim not created yet",
+			// The backup waits for the upgrade after the claim was created
+			values:              map[string]string{},
+			expectedErrorRegexp: notFound,
+		},
+		{
+			name: "with review app",
+			values: map[string]string{
+				"databaseBackup.pvc.existingClaim": "backups",
+				"gitlab.envName":                   "review/feature",
+			},
+			expectedErrorRegexp: notFound,
+		},
+		{
+			name: "with review app not skipped",
+			values: map[string]string{
+				"databaseBackup.pvc.existingClaim": "backups",
+				"databaseBackup.skipForReviewApps": "false",
+				"gitlab.envName":                   "review/feature",
+			},
+			expectedVolumeSource: coreV1.VolumeSource{
+				PersistentVolumeClaim: &coreV1.PersistentVolumeClaimVolumeSource{ClaimName: "backups"},
+			},
+			expectedContainers: []string{"postgres:16-alpine"},
+			expectedArgsRegexp: regexp.MustCompile(`pg_dump`),
+		},
+		{
+			name: "without migrate command",
+			values: map[string]string{
+				"databaseBackup.pvc.existingClaim": "backups",
+				"application.migrateCommand":       "",
+			},
+			expectedErrorRegexp: notFound,
+		},
+		{
+			name: "when disabled",
+			values: map[string]string{
+				"databaseBackup.enabled":           "false",
+				"databaseBackup.pvc.existingClaim": "backups",
+			},
+			expectedErrorRegexp: notFound,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			values := map[string]string{
+				"databaseBackup.enabled":     "true",
+				"application.migrateCommand": "echo migrate",
+				"application.database_url":   "postgres://user:password@db:5432/production",
+				"gitlab.envName":             "production",
+			}
+			mergeStringMap(values, tc.values)
+			opts := &helm.Options{
+				SetValues: values,
+			}
+			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp)
+			if tc.expectedErrorRegexp != nil {
+				return
+			}
+
+			job := new(batchV1.Job)
+			helm.UnmarshalK8SYaml(t, output, job)
+			podSpec := job.Spec.Template.Spec
+
+			require.Equal(t, releaseName+"-db-backup", job.Name)
+			require.Equal(t, "pre-upgrade", job.Annotations["helm.sh/hook"])
+			require.Equal(t, coreV1.RestartPolicyNever, podSpec.RestartPolicy)
+			require.Equal(t, []coreV1.Volume{{Name: "backups", VolumeSource: tc.expectedVolumeSource}}, podSpec.Volumes)
+
+			var initContainerImages, containerImages []string
+			var args string
+			for _, container := range podSpec.InitContainers {
+				initContainerImages = append(initContainerImages, container.Image)
+				args += strings.Join(container.Args, "\n")
+			}
+			for _, container := range podSpec.Containers {
+				containerImages = append(containerImages, container.Image)
+				args += strings.Join(container.Args, "\n")
+			}
+			require.Equal(t, tc.expectedInitContainers, initContainerImages)
+			require.Equal(t, tc.expectedContainers, containerImages)
+			require.Regexp(t, tc.expectedArgsRegexp, args)
+
+			dumpContainer := podSpec.Containers[0]
+			if len(podSpec.InitContainers) > 0 {
+				dumpContainer = podSpec.InitContainers[0]
+			}
+			require.Contains(t, dumpContainer.Env, coreV1.EnvVar{Name: "DATABASE_URL", Value: "postgres://user:password@db:5432/production"})
+		})
+	}
+}
+
+func TestDatabaseBackupHookOrdering(t *testing.T) {
+	releaseName := "db-backup-ordering-test"
+	templates := []string{"templates/db-backup-hook.yaml", "templates/db-migrate-hook.yaml"}
+
+	opts := &helm.Options{
+		ValuesFiles: []string{"../testdata/configmap.yaml"},
+		SetValues: map[string]string{
+			"databaseBackup.enabled":           "true",
+			"databaseBackup.pvc.existingClaim": "backups",
+			"application.migrateCommand":       "echo migrate",
+		},
+	}
+	output := mustRenderTemplate(t, opts, releaseName, templates, nil)
+
+	weights := map[string]int{}
+	for _, document := range strings.Split(output, "---")[1:] {
+		var object struct {
+			Kind     string
+			Metadata struct {
+				Name        string
+				Annotations map[string]string
+			}
+		}
+		helm.UnmarshalK8SYaml(t, document, &object)
+		require.Contains(t, object.Metadata.Annotations["helm.sh/hook"], "pre-upgrade")
+		weight, err := strconv.Atoi(object.Metadata.Annotations["helm.sh/hook-weight"])
+		require.NoError(t, err)
+		weights[object.Metadata.Name] = weight
+	}
+
+	require.Less(t, weights[releaseName+"-db-backup"], weights[releaseName+"-db-migrate"])
+}
+
+func TestDatabaseBackupPvcTemplate(t *testing.T) {
+	templates := []string{"templates/db-backup-pvc.yaml"}
+	releaseName := "db-backup-pvc-test"
+	customStorageClassName := "backups"
+
+	tcs := []struct {
+		name   string
+		values map[string]string
+
+		expectedStorageClassName *string
+		expectedSize             string
+		expectedErrorRegexp      *regexp.Regexp
+	}{
+		{
+			name:         "defaults",
+			values:       map[string]string{"databaseBackup.enabled": "true"},
+			expectedSize: "8Gi",
+		},
+		{
+			name: "with size and storage class",
+			values: map[string]string{
+				"databaseBackup.enabled":          "true",
+				"databaseBackup.pvc.size":         "50Gi",
+				"databaseBackup.pvc.storageClass": customStorageClassName,
+			},
+			expectedStorageClassName: &customStorageClassName,
+			expectedSize:             "50Gi",
+		},
+		{
+			name: "with existing claim",
+			values: map[string]string{
+				"databaseBackup.enabled":           "true",
+				"databaseBackup.pvc.existingClaim": "backups",
+			},
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/db-backup-pvc.yaml in chart"),
+		},
+		{
+			name: "with s3",
+			values: map[string]string{
+				"databaseBackup.enabled":     "true",
+				"databaseBackup.destination": "s3",
+			},
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/db-backup-pvc.yaml in chart"),
+		},
+		{
+			name:                "when disabled",
+			values:              map[string]string{},
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/db-backup-pvc.yaml in chart"),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &helm.Options{
+				SetValues: tc.values,
+			}
+			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp)
+			if tc.expectedErrorRegexp != nil {
+				return
+			}
+
+			pvc := new(coreV1.PersistentVolumeClaim)
+			helm.UnmarshalK8SYaml(t, output, pvc)
+
+			require.Equal(t, releaseName+"-auto-deploy-db-backup", pvc.Name)
+			require.Equal(t, "keep", pvc.Annotations["helm.sh/resource-policy"])
+			require.Equal(t, []coreV1.PersistentVolumeAccessMode{coreV1.ReadWriteOnce}, pvc.Spec.AccessModes)
+			require.Equal(t, resource.MustParse(tc.expectedSize), pvc.Spec.Resources.Requests["storage"])
+			require.Equal(t, tc.expectedStorageClassName, pvc.Spec.StorageClassName)
+		})
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/stretchr/testify/require"
 	appsV1 "k8s.io/api/apps/v1"
+	batchV1 "k8s.io/api/batch/v1"
 	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 func TestMigrateDatabaseUrlEnvironmentVariable(t *testing.T) {
@@ -333,3 +335,393 @@ func TestMigrateDatabaseTemplateWithExtraEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestMigrateAndInitializeWithSyncedSecrets(t *testing.T) {
+	releaseName := "migrate-synced-secrets-test"
+	readOnly := true
+	// Synced Secrets are optional, they only exist after the upgrade that enables them
+	optional := true
+	applicationSecret := coreV1.EnvFromSource{SecretRef: &coreV1.SecretEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: "gitlab-secretname-test"}}}
+	externalSecret := coreV1.EnvFromSource{SecretRef: &coreV1.SecretEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: releaseName + "-auto-deploy-external"}, Optional: &optional}}
+	csiSecret := coreV1.EnvFromSource{SecretRef: &coreV1.SecretEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: releaseName + "-auto-deploy-csi"}, Optional: &optional}}
+	csiVolume := coreV1.Volume{
+		Name: "secrets-store",
+		VolumeSource: coreV1.VolumeSource{
+			CSI: &coreV1.CSIVolumeSource{
+				Driver:           "secrets-store.csi.k8s.io",
+				ReadOnly:         &readOnly,
+				VolumeAttributes: map[string]string{"secretProviderClass": releaseName + "-auto-deploy"},
+			},
+		},
+	}
+	csiVolumeMount := coreV1.VolumeMount{Name: "secrets-store", MountPath: "/mnt/secrets-store", ReadOnly: true}
+
+	jobs := []struct {
+		CaseName string
+		Values   map[string]string
+		Template string
+	}{
+		{
+			CaseName: "db-migrate",
+			Values:   map[string]string{"application.migrateCommand": "echo migrate"},
+			Template: "templates/db-migrate-hook.yaml",
+		},
+		{
+			CaseName: "db-initialize",
+			Values:   map[string]string{"application.initializeCommand": "echo initialize"},
+			Template: "templates/db-initialize-job.yaml",
+		},
+	}
+
+	tcs := []struct {
+		CaseName string
+		Values   map[string]string
+
+		ExpectedEnvFrom      []coreV1.EnvFromSource
+		ExpectedVolumes      []coreV1.Volume
+		ExpectedVolumeMounts []coreV1.VolumeMount
+	}{
+		{
+			CaseName:             "with ExternalSecret and SecretProviderClass",
+			ExpectedEnvFrom:      []coreV1.EnvFromSource{applicationSecret, externalSecret, csiSecret},
+			ExpectedVolumes:      []coreV1.Volume{csiVolume},
+			ExpectedVolumeMounts: []coreV1.VolumeMount{csiVolumeMount},
+		},
+		{
+			CaseName:        "with ExternalSecret",
+			Values:          map[string]string{"secretProviderClass.enabled": "false"},
+			ExpectedEnvFrom: []coreV1.EnvFromSource{applicationSecret, externalSecret},
+		},
+		{
+			CaseName:             "with SecretProviderClass",
+			Values:               map[string]string{"externalSecret.enabled": "false"},
+			ExpectedEnvFrom:      []coreV1.EnvFromSource{applicationSecret, csiSecret},
+			ExpectedVolumes:      []coreV1.Volume{csiVolume},
+			ExpectedVolumeMounts: []coreV1.VolumeMount{csiVolumeMount},
+		},
+		{
+			CaseName: "with mount-only SecretProviderClass",
+			Values: map[string]string{
+				"externalSecret.enabled":         "false",
+				"secretProviderClass.secretData": "null",
+			},
+			ExpectedEnvFrom:      []coreV1.EnvFromSource{applicationSecret},
+			ExpectedVolumes:      []coreV1.Volume{csiVolume},
+			ExpectedVolumeMounts: []coreV1.VolumeMount{csiVolumeMount},
+		},
+	}
+
+	for _, job := range jobs {
+		for _, tc := range tcs {
+			t.Run(job.CaseName+" "+tc.CaseName, func(t *testing.T) {
+				values := map[string]string{}
+				for key, value := range job.Values {
+					values[key] = value
+				}
+				for key, value := range tc.Values {
+					values[key] = value
+				}
+				options := &helm.Options{
+					ValuesFiles: []string{"../testdata/synced-secrets.yaml"},
+					SetValues:   values,
+				}
+
+				output := mustRenderTemplate(t, options, releaseName, []string{job.Template}, nil)
+
+				hook := new(batchV1.Job)
+				helm.UnmarshalK8SYaml(t, output, hook)
+				podSpec := hook.Spec.Template.Spec
+				require.Equal(t, tc.ExpectedEnvFrom, podSpec.Containers[0].EnvFrom)
+				require.Equal(t, tc.ExpectedVolumes, podSpec.Volumes)
+				require.Equal(t, tc.ExpectedVolumeMounts, podSpec.Containers[0].VolumeMounts)
+			})
+		}
+	}
+}
+
+func TestMigrateAndInitializeWithExtraSecrets(t *testing.T) {
+	releaseName := "migrate-extra-secrets-test"
+	expectedEnvFrom := []coreV1.EnvFromSource{
+		{SecretRef: &coreV1.SecretEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: "production-secret"}}},
+		{SecretRef: &coreV1.SecretEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: "production-secret-smtp"}}},
+	}
+	expectedVolumes := []coreV1.Volume{
+		{Name: "extra-secret-0", VolumeSource: coreV1.VolumeSource{Secret: &coreV1.SecretVolumeSource{SecretName: "production-secret-files"}}},
+		{Name: "extra-secret-2", VolumeSource: coreV1.VolumeSource{Secret: &coreV1.SecretVolumeSource{SecretName: "production-secret-tls-api"}}},
+	}
+	expectedVolumeMounts := []coreV1.VolumeMount{
+		{Name: "extra-secret-0", MountPath: "/etc/secrets/files", ReadOnly: true},
+		{Name: "extra-secret-2", MountPath: "/etc/secrets/tls-api", ReadOnly: true},
+	}
+
+	tcs := []struct {
+		CaseName string
+		Values   map[string]string
+		Template string
+	}{
+		{
+			CaseName: "db-migrate",
+			Values:   map[string]string{"application.migrateCommand": "echo migrate"},
+			Template: "templates/db-migrate-hook.yaml",
+		},
+		{
+			CaseName: "db-initialize",
+			Values:   map[string]string{"application.initializeCommand": "echo initialize"},
+			Template: "templates/db-initialize-job.yaml",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.CaseName, func(t *testing.T) {
+			options := &helm.Options{
+				ValuesFiles: []string{"../testdata/extra-secrets.yaml"},
+				SetValues:   tc.Values,
+			}
+
+			output := mustRenderTemplate(t, options, releaseName, []string{tc.Template}, nil)
+
+			job := new(batchV1.Job)
+			helm.UnmarshalK8SYaml(t, output, job)
+			podSpec := job.Spec.Template.Spec
+			require.Equal(t, expectedEnvFrom, podSpec.Containers[0].EnvFrom)
+			require.Equal(t, expectedVolumes, podSpec.Volumes)
+			require.Equal(t, expectedVolumeMounts, podSpec.Containers[0].VolumeMounts)
+		})
+	}
+}
+
+func TestMigrateAndInitializeWithConfigMap(t *testing.T) {
+	releaseName := "migrate-configmap-test"
+	// Hooks run before the release ConfigMaps are created, the configuration is read from the values
+	expectedEnv := []coreV1.EnvVar{
+		{Name: "LOG_LEVEL", Value: "info"},
+		{Name: "WORKER_COUNT", Value: "4"},
+	}
+	expectedAnnotations := map[string]string{
+		"app.gitlab.com/config-file-0": "key: value\n",
+		"app.gitlab.com/config-file-1": "other: value\n",
+	}
+	expectedVolume := coreV1.Volume{
+		Name: "config-files",
+		VolumeSource: coreV1.VolumeSource{
+			DownwardAPI: &coreV1.DownwardAPIVolumeSource{
+				Items: []coreV1.DownwardAPIVolumeFile{
+					{Path: "0-settings.yaml", FieldRef: &coreV1.ObjectFieldSelector{FieldPath: "metadata.annotations['app.gitlab.com/config-file-0']"}},
+					{Path: "1-settings.yaml", FieldRef: &coreV1.ObjectFieldSelector{FieldPath: "metadata.annotations['app.gitlab.com/config-file-1']"}},
+				},
+			},
+		},
+	}
+	expectedVolumeMounts := []coreV1.VolumeMount{
+		{Name: "config-files", MountPath: "/app/config/settings.yaml", SubPath: "0-settings.yaml", ReadOnly: true},
+		{Name: "config-files", MountPath: "/etc/app/settings.yaml", SubPath: "1-settings.yaml", ReadOnly: true},
+	}
+
+	tcs := []struct {
+		CaseName string
+		Values   map[string]string
+		Template string
+	}{
+		{
+			CaseName: "db-migrate",
+			Values:   map[string]string{"application.migrateCommand": "echo migrate"},
+			Template: "templates/db-migrate-hook.yaml",
+		},
+		{
+			CaseName: "db-initialize",
+			Values:   map[string]string{"application.initializeCommand": "echo initialize"},
+			Template: "templates/db-initialize-job.yaml",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.CaseName, func(t *testing.T) {
+			options := &helm.Options{
+				ValuesFiles: []string{"../testdata/configmap.yaml"},
+				SetValues:   tc.Values,
+			}
+
+			output := mustRenderTemplate(t, options, releaseName, []string{tc.Template}, nil)
+
+			job := new(batchV1.Job)
+			helm.UnmarshalK8SYaml(t, output, job)
+			podSpec := job.Spec.Template.Spec
+			require.Empty(t, podSpec.Containers[0].EnvFrom)
+			require.Equal(t, expectedEnv, podSpec.Containers[0].Env[:2])
+			require.Equal(t, expectedAnnotations, job.Spec.Template.ObjectMeta.Annotations)
+			require.Equal(t, []coreV1.Volume{expectedVolume}, podSpec.Volumes)
+			require.Equal(t, expectedVolumeMounts, podSpec.Containers[0].VolumeMounts)
+		})
+	}
+}
+
+func TestMigrateAndInitializeWithCloudNativePG(t *testing.T) {
+	releaseName := "migrate-cloudnativepg-test"
+	expectedDatabaseURL := secretKeyEnvVar("DATABASE_URL", releaseName+"-auto-deploy-postgres-app", "uri")
+
+	tcs := []struct {
+		CaseName string
+		Values   map[string]string
+		Template string
+	}{
+		{
+			CaseName: "db-migrate",
+			Values:   map[string]string{"application.migrateCommand": "echo migrate"},
+			Template: "templates/db-migrate-hook.yaml",
+		},
+		{
+			CaseName: "db-initialize",
+			Values:   map[string]string{"application.initializeCommand": "echo initialize"},
+			Template: "templates/db-initialize-job.yaml",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.CaseName, func(t *testing.T) {
+			values := map[string]string{
+				"postgresql.managed":         "true",
+				"postgresql.managedProvider": "cloudnativepg",
+			}
+			mergeStringMap(values, tc.Values)
+			options := &helm.Options{
+				SetValues: values,
+			}
+
+			output := mustRenderTemplate(t, options, releaseName, []string{tc.Template}, nil)
+
+			job := new(batchV1.Job)
+			helm.UnmarshalK8SYaml(t, output, job)
+			require.Contains(t, job.Spec.Template.Spec.Containers[0].Env, expectedDatabaseURL)
+		})
+	}
+}
+
+func TestMigrateAndInitializeJobSpec(t *testing.T) {
+	releaseName := "migrate-job-spec-test"
+	topLevelNodeSelector := map[string]string{"pool": "web"}
+	topLevelTolerations := []coreV1.Toleration{{Key: "web", Operator: coreV1.TolerationOpExists, Effect: coreV1.TaintEffectNoSchedule}}
+	topLevelResources := coreV1.ResourceRequirements{Requests: coreV1.ResourceList{"memory": resource.MustParse("128Mi")}}
+	topLevelVolumes := []coreV1.Volume{{Name: "cache", VolumeSource: coreV1.VolumeSource{EmptyDir: &coreV1.EmptyDirVolumeSource{}}}}
+	topLevelVolumeMounts := []coreV1.VolumeMount{{Name: "cache", MountPath: "/cache"}}
+	runAsUser := int64(1000)
+	backoffLimit := int32(0)
+	activeDeadlineSeconds := int64(3600)
+	ttlSecondsAfterFinished := int32(86400)
+
+	for _, job := range []struct {
+		name     string
+		command  string
+		block    string
+		template string
+	}{
+		{name: "db-migrate", command: "migrateCommand", block: "migrate", template: "templates/db-migrate-hook.yaml"},
+		{name: "db-initialize", command: "initializeCommand", block: "initialize", template: "templates/db-initialize-job.yaml"},
+	} {
+		tcs := []struct {
+			name   string
+			values map[string]string
+
+			expectedCommand                 []string
+			expectedArgs                    []string
+			expectedRestartPolicy           coreV1.RestartPolicy
+			expectedBackoffLimit            *int32
+			expectedActiveDeadlineSeconds   *int64
+			expectedTTLSecondsAfterFinished *int32
+			expectedNodeSelector            map[string]string
+			expectedTolerations             []coreV1.Toleration
+			expectedResources               coreV1.ResourceRequirements
+			expectedVolumes                 []coreV1.Volume
+			expectedVolumeMounts            []coreV1.VolumeMount
+		}{
+			{
+				name:                  "defaults",
+				expectedCommand:       []string{"/bin/sh"},
+				expectedArgs:          []string{"-c", "echo run"},
+				expectedRestartPolicy: coreV1.RestartPolicyNever,
+				expectedNodeSelector:  topLevelNodeSelector,
+				expectedTolerations:   topLevelTolerations,
+				expectedResources:     topLevelResources,
+				expectedVolumes:       topLevelVolumes,
+				expectedVolumeMounts:  topLevelVolumeMounts,
+			},
+			{
+				name: "with job settings",
+				values: map[string]string{
+					"application." + job.block + ".command[0]":                      "/bin/bash",
+					"application." + job.block + ".command[1]":                      "-ec",
+					"application." + job.block + ".restartPolicy":                   "OnFailure",
+					"application." + job.block + ".backoffLimit":                    "0",
+					"application." + job.block + ".activeDeadlineSeconds":           "3600",
+					"application." + job.block + ".ttlSecondsAfterFinished":         "86400",
+					"application." + job.block + ".nodeSelector.pool":               "batch",
+					"application." + job.block + ".tolerations[0].key":              "batch",
+					"application." + job.block + ".tolerations[0].operator":         "Exists",
+					"application." + job.block + ".resources.limits.memory":         "4Gi",
+					"application." + job.block + ".extraVolumes[0].name":            "tmp",
+					"application." + job.block + ".extraVolumes[0].emptyDir.medium": "Memory",
+					"application." + job.block + ".extraVolumeMounts[0].name":       "tmp",
+					"application." + job.block + ".extraVolumeMounts[0].mountPath":  "/tmp",
+				},
+				expectedCommand:                 []string{"/bin/bash", "-ec"},
+				expectedArgs:                    []string{"echo run"},
+				expectedRestartPolicy:           coreV1.RestartPolicyOnFailure,
+				expectedBackoffLimit:            &backoffLimit,
+				expectedActiveDeadlineSeconds:   &activeDeadlineSeconds,
+				expectedTTLSecondsAfterFinished: &ttlSecondsAfterFinished,
+				expectedNodeSelector:            map[string]string{"pool": "batch"},
+				expectedTolerations:             []coreV1.Toleration{{Key: "batch", Operator: coreV1.TolerationOpExists}},
+				expectedResources:               coreV1.ResourceRequirements{Limits: coreV1.ResourceList{"memory": resource.MustParse("4Gi")}},
+				expectedVolumes:                 []coreV1.Volume{{Name: "tmp", VolumeSource: coreV1.VolumeSource{EmptyDir: &coreV1.EmptyDirVolumeSource{Medium: coreV1.StorageMediumMemory}}}},
+				expectedVolumeMounts:            []coreV1.VolumeMount{{Name: "tmp", MountPath: "/tmp"}},
+			},
+			{
+				// The preset limits could be too low for a migration
+				name: "with resources preset",
+				values: map[string]string{
+					"resources":       "null",
+					"resourcesPreset": "nano",
+				},
+				expectedCommand:       []string{"/bin/sh"},
+				expectedArgs:          []string{"-c", "echo run"},
+				expectedRestartPolicy: coreV1.RestartPolicyNever,
+				expectedNodeSelector:  topLevelNodeSelector,
+				expectedTolerations:   topLevelTolerations,
+				expectedVolumes:       topLevelVolumes,
+				expectedVolumeMounts:  topLevelVolumeMounts,
+			},
+		}
+
+		for _, tc := range tcs {
+			t.Run(job.name+" "+tc.name, func(t *testing.T) {
+				values := map[string]string{
+					"application." + job.command: "echo run",
+				}
+				mergeStringMap(values, tc.values)
+				options := &helm.Options{
+					ValuesFiles: []string{"../testdata/job-settings.yaml"},
+					SetValues:   values,
+				}
+
+				output := mustRenderTemplate(t, options, releaseName, []string{job.template}, nil)
+
+				renderedJob := new(batchV1.Job)
+				helm.UnmarshalK8SYaml(t, output, renderedJob)
+				require.Equal(t, releaseName+"-"+job.name, renderedJob.Name)
+				require.Equal(t, tc.expectedBackoffLimit, renderedJob.Spec.BackoffLimit)
+				require.Equal(t, tc.expectedActiveDeadlineSeconds, renderedJob.Spec.ActiveDeadlineSeconds)
+				require.Equal(t, tc.expectedTTLSecondsAfterFinished, renderedJob.Spec.TTLSecondsAfterFinished)
+
+				podSpec := renderedJob.Spec.Template.Spec
+				require.Equal(t, tc.expectedRestartPolicy, podSpec.RestartPolicy)
+				require.Equal(t, tc.expectedNodeSelector, podSpec.NodeSelector)
+				require.Equal(t, tc.expectedTolerations, podSpec.Tolerations)
+				require.Equal(t, &coreV1.PodSecurityContext{RunAsUser: &runAsUser}, podSpec.SecurityContext)
+				require.Equal(t, tc.expectedVolumes, podSpec.Volumes)
+				require.Equal(t, tc.expectedCommand, podSpec.Containers[0].Command)
+				require.Equal(t, tc.expectedArgs, podSpec.Containers[0].Args)
+				require.Equal(t, tc.expectedResources, podSpec.Containers[0].Resources)
+				require.Equal(t, tc.expectedVolumeMounts, podSpec.Containers[0].VolumeMounts)
+			})
+		}
+	}
+}
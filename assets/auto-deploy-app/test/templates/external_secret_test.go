@@ -0,0 +1,87 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestExternalSecretTemplate(t *testing.T) {
+	templates := []string{"templates/external-secret.yaml"}
+	releaseName := "external-secret-test"
+
+	tcs := []struct {
+		name       string
+		valueFiles []string
+		values     map[string]string
+
+		expectedTargetName  string
+		expectedStoreKind   string
+		expectedErrorRegexp *regexp.Regexp
+	}{
+		{
+			name:                "defaults",
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/external-secret.yaml in chart"),
+		},
+		{
+			name:               "with external secret",
+			valueFiles:         []string{"../testdata/synced-secrets.yaml"},
+			expectedTargetName: releaseName + "-auto-deploy-external",
+			expectedStoreKind:  "ClusterSecretStore",
+		},
+		{
+			name:       "with custom secret name",
+			valueFiles: []string{"../testdata/synced-secrets.yaml"},
+			values: map[string]string{
+				"externalSecret.secretName": "my-app-secrets",
+			},
+			expectedTargetName: "my-app-secrets",
+			expectedStoreKind:  "ClusterSecretStore",
+		},
+		{
+			name: "without secret store",
+			values: map[string]string{
+				"externalSecret.enabled": "true",
+			},
+			expectedErrorRegexp: regexp.MustCompile("externalSecret.secretStoreRef.name is required"),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &helm.Options{
+				ValuesFiles: tc.valueFiles,
+				SetValues:   tc.values,
+			}
+			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp)
+
+			if tc.expectedErrorRegexp != nil {
+				return
+			}
+
+			externalSecret := new(unstructured.Unstructured)
+			helm.UnmarshalK8SYaml(t, output, &externalSecret.Object)
+			require.Equal(t, "ExternalSecret", externalSecret.GetKind())
+			require.Equal(t, releaseName+"-auto-deploy", externalSecret.GetName())
+
+			targetName, _, err := unstructured.NestedString(externalSecret.Object, "spec", "target", "name")
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedTargetName, targetName)
+
+			storeKind, _, err := unstructured.NestedString(externalSecret.Object, "spec", "secretStoreRef", "kind")
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedStoreKind, storeKind)
+
+			data, _, err := unstructured.NestedSlice(externalSecret.Object, "spec", "data")
+			require.NoError(t, err)
+			require.Len(t, data, 1)
+
+			dataFrom, _, err := unstructured.NestedSlice(externalSecret.Object, "spec", "dataFrom")
+			require.NoError(t, err)
+			require.Len(t, dataFrom, 1)
+		})
+	}
+}
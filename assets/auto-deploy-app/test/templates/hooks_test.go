@@ -0,0 +1,133 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+	batchV1 "k8s.io/api/batch/v1"
+	coreV1 "k8s.io/api/core/v1"
+)
+
+func TestHooksTemplate(t *testing.T) {
+	templates := []string{"templates/hooks.yaml"}
+	releaseName := "hooks-test"
+
+	type expectedHook struct {
+		name         string
+		hook         string
+		weight       string
+		deletePolicy string
+		args         []string
+	}
+
+	tcs := []struct {
+		name   string
+		values map[string]string
+
+		expectedHooks       []expectedHook
+		expectedErrorRegexp *regexp.Regexp
+	}{
+		{
+			name: "with hooks",
+			values: map[string]string{
+				"hooks.smoke-test.hook":         `post-install\,post-upgrade`,
+				"hooks.smoke-test.weight":       "5",
+				"hooks.smoke-test.deletePolicy": `before-hook-creation\,hook-succeeded`,
+				"hooks.smoke-test.command":      "curl --fail http://hooks-test/health",
+				"hooks.cleanup.hook":            "pre-delete",
+				"hooks.cleanup.weight":          "-5",
+				"hooks.cleanup.command":         "rake cleanup",
+				"hooks.connection.hook":         "test",
+				"hooks.connection.command":      "rake smoke",
+			},
+			expectedHooks: []expectedHook{
+				{name: "hooks-test-cleanup", hook: "pre-delete", weight: "-5", deletePolicy: "before-hook-creation", args: []string{"-c", "rake cleanup"}},
+				{name: "hooks-test-connection", hook: "test", weight: "0", deletePolicy: "before-hook-creation", args: []string{"-c", "rake smoke"}},
+				{name: "hooks-test-smoke-test", hook: "post-install,post-upgrade", weight: "5", deletePolicy: "before-hook-creation,hook-succeeded", args: []string{"-c", "curl --fail http://hooks-test/health"}},
+			},
+		},
+		{
+			name: "without hook phase",
+			values: map[string]string{
+				"hooks.smoke-test.command": "echo smoke",
+			},
+			expectedErrorRegexp: regexp.MustCompile("hooks.smoke-test.hook is required"),
+		},
+		{
+			name: "without command",
+			values: map[string]string{
+				"hooks.smoke-test.hook": "post-upgrade",
+			},
+			expectedErrorRegexp: regexp.MustCompile("hooks.smoke-test.command is required"),
+		},
+		{
+			name:                "without hooks",
+			values:              map[string]string{},
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/hooks.yaml in chart"),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &helm.Options{
+				SetValues: tc.values,
+			}
+			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp)
+			if tc.expectedErrorRegexp != nil {
+				return
+			}
+
+			documents := strings.Split(output, "---")[1:]
+			require.Len(t, documents, len(tc.expectedHooks))
+			for i, expected := range tc.expectedHooks {
+				job := new(batchV1.Job)
+				helm.UnmarshalK8SYaml(t, documents[i], job)
+
+				require.Equal(t, expected.name, job.Name)
+				require.Equal(t, expected.hook, job.Annotations["helm.sh/hook"])
+				require.Equal(t, expected.weight, job.Annotations["helm.sh/hook-weight"])
+				require.Equal(t, expected.deletePolicy, job.Annotations["helm.sh/hook-delete-policy"])
+				require.Equal(t, coreV1.RestartPolicyNever, job.Spec.Template.Spec.RestartPolicy)
+				require.Equal(t, []string{"/bin/sh"}, job.Spec.Template.Spec.Containers[0].Command)
+				require.Equal(t, expected.args, job.Spec.Template.Spec.Containers[0].Args)
+			}
+		})
+	}
+}
+
+func TestHooksTemplateWithJobSettings(t *testing.T) {
+	releaseName := "hooks-job-settings-test"
+	backoffLimit := int32(3)
+
+	opts := &helm.Options{
+		SetValues: map[string]string{
+			"hooks.smoke-test.hook":              "post-upgrade",
+			"hooks.smoke-test.command":           "echo smoke",
+			"hooks.smoke-test.backoffLimit":      "3",
+			"hooks.smoke-test.nodeSelector.pool": "batch",
+			"application.secretName":             "hooks-secret",
+			"application.database_url":           "postgres://db",
+			"extraEnv[0].name":                   "LOG_LEVEL",
+			"extraEnv[0].value":                  "debug",
+			"image.repository":                   "registry.example.com/app",
+			"image.tag":                          "v1",
+		},
+	}
+	output := mustRenderTemplate(t, opts, releaseName, []string{"templates/hooks.yaml"}, nil)
+
+	job := new(batchV1.Job)
+	helm.UnmarshalK8SYaml(t, output, job)
+	podSpec := job.Spec.Template.Spec
+
+	require.Equal(t, &backoffLimit, job.Spec.BackoffLimit)
+	require.Equal(t, map[string]string{"pool": "batch"}, podSpec.NodeSelector)
+	require.Equal(t, "registry.example.com/app:v1", podSpec.Containers[0].Image)
+	require.Equal(t, []coreV1.EnvFromSource{
+		{SecretRef: &coreV1.SecretEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: "hooks-secret"}}},
+	}, podSpec.Containers[0].EnvFrom)
+	require.Contains(t, podSpec.Containers[0].Env, coreV1.EnvVar{Name: "DATABASE_URL", Value: "postgres://db"})
+	require.Contains(t, podSpec.Containers[0].Env, coreV1.EnvVar{Name: "LOG_LEVEL", Value: "debug"})
+}
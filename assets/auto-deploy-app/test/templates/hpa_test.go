@@ -50,6 +50,18 @@ func TestHPA_AutoscalingV1(t *testing.T) {
 			expectedTargetCPU:   80,
 			ExpectedLabels:      nil,
 		},
+		{
+			name:                "with hpa enabled and resources preset",
+			values:              map[string]string{
+				"hpa.enabled": "true",
+				"resourcesPreset": "small",
+			},
+			expectedName:        "hpa-test-auto-deploy",
+			expectedMinReplicas: 1,
+			expectedMaxReplicas: 5,
+			expectedTargetCPU:   80,
+			ExpectedLabels:      nil,
+		},
 		{
 			name:                "with hpa enabled and requests, label defined",
 			values:              map[string]string{
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+	coreV1 "k8s.io/api/core/v1"
+)
+
+func TestIngressBasicAuthSecretTemplate(t *testing.T) {
+	templates := []string{"templates/ingress-basic-auth.yaml"}
+	releaseName := "ingress-basic-auth-test"
+
+	tcs := []struct {
+		name   string
+		values map[string]string
+
+		expectedName        string
+		expectedAuth        string
+		expectedErrorRegexp *regexp.Regexp
+	}{
+		{
+			name:                "defaults",
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/ingress-basic-auth.yaml in chart"),
+		},
+		{
+			name: "with htpasswd",
+			values: map[string]string{
+				"ingress.basicAuth.enabled":  "true",
+				"ingress.basicAuth.htpasswd": "user:$apr1$hash",
+			},
+			expectedName: releaseName + "-auto-deploy-basic-auth",
+			expectedAuth: "user:$apr1$hash",
+		},
+		{
+			name: "with htpasswd but disabled",
+			values: map[string]string{
+				"ingress.basicAuth.enabled":  "false",
+				"ingress.basicAuth.htpasswd": "user:$apr1$hash",
+			},
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/ingress-basic-auth.yaml in chart"),
+		},
+		{
+			name: "with an existing secret",
+			values: map[string]string{
+				"ingress.basicAuth.enabled":    "true",
+				"ingress.basicAuth.secretName": "my-htpasswd",
+				"ingress.basicAuth.htpasswd":   "user:$apr1$hash",
+			},
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/ingress-basic-auth.yaml in chart"),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &helm.Options{
+				SetValues: tc.values,
+			}
+			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp)
+
+			if tc.expectedErrorRegexp != nil {
+				return
+			}
+
+			secret := new(coreV1.Secret)
+			helm.UnmarshalK8SYaml(t, output, secret)
+			require.Equal(t, tc.expectedName, secret.ObjectMeta.Name)
+			require.Equal(t, coreV1.SecretTypeOpaque, secret.Type)
+			require.Equal(t, tc.expectedAuth, string(secret.Data["auth"]))
+		})
+	}
+}
@@ -34,6 +34,34 @@ SecRule REQUEST_HEADERS:Content-Type \"text/plain\" \"log,deny,id:\'20010\',stat
 	modSecurityAnnotations["nginx.ingress.kubernetes.io/modsecurity-snippet"] = modSecuritySnippet
 	secRulesAnnotations["nginx.ingress.kubernetes.io/modsecurity-snippet"] = modSecuritySnippetWithSecRules
 
+	crsSnippet := `SecRuleEngine On
+SecAction \"id:900000,phase:1,pass,nolog,t:none,setvar:tx.paranoia_level=2\"
+SecAction \"id:900110,phase:1,pass,nolog,t:none,setvar:tx.inbound_anomaly_score_threshold=10,setvar:tx.outbound_anomaly_score_threshold=8\"
+SecAction \"id:900990,phase:1,pass,nolog,t:none,ctl:ruleRemoveById=942100,ctl:ruleRemoveById=920350\"
+`
+	crsRules := `SecRule ARGS:foo \"@contains bar\" \"id:1001,phase:2,deny,msg:\'Bar is not allowed\'\"
+SecRule REQUEST_URI \"@beginsWith /admin\" \"id:1002,phase:1,deny\"
+`
+	crsSecRules := `SecRule REQUEST_HEADERS:User-Agent \"scanner\" \"log,deny,id:107,status:403,msg:\'Scanner Identified\'\"
+`
+	crsAnnotations := map[string]string{
+		"nginx.ingress.kubernetes.io/enable-owasp-core-rules": "true",
+		"nginx.ingress.kubernetes.io/modsecurity-snippet":     crsSnippet + crsRules + crsSecRules,
+	}
+	mergeStringMap(crsAnnotations, defaultAnnotations)
+	mergeStringMap(crsAnnotations, defaultModSecurityAnnotations)
+	includeAnnotations := map[string]string{
+		"nginx.ingress.kubernetes.io/enable-owasp-core-rules": "true",
+		"nginx.ingress.kubernetes.io/modsecurity-snippet":     crsSnippet + "Include /etc/nginx/modsecurity/custom.conf\n" + crsSecRules,
+	}
+	mergeStringMap(includeAnnotations, defaultAnnotations)
+	mergeStringMap(includeAnnotations, defaultModSecurityAnnotations)
+	crsDisabledAnnotations := map[string]string{
+		"nginx.ingress.kubernetes.io/modsecurity-snippet": "SecRuleEngine On\n" + crsRules + crsSecRules,
+	}
+	mergeStringMap(crsDisabledAnnotations, defaultAnnotations)
+	mergeStringMap(crsDisabledAnnotations, defaultModSecurityAnnotations)
+
 	tcs := []struct {
 		name       string
 		valueFiles []string
@@ -54,6 +82,23 @@ SecRule REQUEST_HEADERS:Content-Type \"text/plain\" \"log,deny,id:\'20010\',stat
 			valueFiles: []string{"../testdata/modsecurity-ingress.yaml"},
 			meta:       metav1.ObjectMeta{Annotations: secRulesAnnotations},
 		},
+		{
+			name:       "with CRS tuning and rules",
+			valueFiles: []string{"../testdata/modsecurity-crs.yaml"},
+			meta:       metav1.ObjectMeta{Annotations: crsAnnotations},
+		},
+		{
+			name:       "with rules included from the controller",
+			valueFiles: []string{"../testdata/modsecurity-crs.yaml"},
+			values:     map[string]string{"ingress.modSecurity.rulesIncludePath": "/etc/nginx/modsecurity/custom.conf"},
+			meta:       metav1.ObjectMeta{Annotations: includeAnnotations},
+		},
+		{
+			name:       "with CRS disabled",
+			valueFiles: []string{"../testdata/modsecurity-crs.yaml"},
+			values:     map[string]string{"ingress.modSecurity.crs.enabled": "false"},
+			meta:       metav1.ObjectMeta{Annotations: crsDisabledAnnotations},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -72,6 +117,121 @@ SecRule REQUEST_HEADERS:Content-Type \"text/plain\" \"log,deny,id:\'20010\',stat
 	}
 }
 
+func TestIngressTemplate_AnnotationPresets(t *testing.T) {
+	templates := []string{"templates/ingress.yaml"}
+	releaseName := "ingress-presets-test"
+	defaultAnnotations := map[string]string{
+		"kubernetes.io/ingress.class": "nginx",
+		"kubernetes.io/tls-acme":      "true",
+	}
+	presetAnnotations := map[string]string{
+		"nginx.ingress.kubernetes.io/proxy-body-size":        "8m",
+		"nginx.ingress.kubernetes.io/limit-rps":              "10",
+		"nginx.ingress.kubernetes.io/limit-connections":      "5",
+		"nginx.ingress.kubernetes.io/limit-burst-multiplier": "3",
+		"nginx.ingress.kubernetes.io/enable-cors":            "true",
+		"nginx.ingress.kubernetes.io/cors-allow-origin":      "https://example.com, https://example.org",
+		"nginx.ingress.kubernetes.io/cors-allow-methods":     "GET, POST",
+		"nginx.ingress.kubernetes.io/cors-allow-credentials": "false",
+		"nginx.ingress.kubernetes.io/cors-max-age":           "600",
+		"nginx.ingress.kubernetes.io/whitelist-source-range": "10.0.0.0/8,192.168.0.0/16",
+	}
+	mergeStringMap(presetAnnotations, defaultAnnotations)
+	customizedAnnotations := map[string]string{
+		"nginx.ingress.kubernetes.io/limit-rps": "50",
+		"custom":                                "annotation",
+	}
+	mergeStringMap(customizedAnnotations, presetAnnotations)
+	customizedAnnotations["nginx.ingress.kubernetes.io/limit-rps"] = "50"
+	basicAuthAnnotations := map[string]string{
+		"nginx.ingress.kubernetes.io/auth-type":   "basic",
+		"nginx.ingress.kubernetes.io/auth-secret": releaseName + "-auto-deploy-basic-auth",
+		"nginx.ingress.kubernetes.io/auth-realm":  "Authentication Required",
+	}
+	mergeStringMap(basicAuthAnnotations, defaultAnnotations)
+	existingSecretAnnotations := map[string]string{
+		"nginx.ingress.kubernetes.io/auth-type":   "basic",
+		"nginx.ingress.kubernetes.io/auth-secret": "my-htpasswd",
+		"nginx.ingress.kubernetes.io/auth-realm":  "Staff only",
+	}
+	mergeStringMap(existingSecretAnnotations, defaultAnnotations)
+
+	tcs := []struct {
+		name         string
+		valueFiles   []string
+		values       map[string]string
+		stringValues map[string]string
+
+		expectedAnnotations map[string]string
+		expectedErrorRegexp *regexp.Regexp
+	}{
+		{
+			name:                "defaults",
+			expectedAnnotations: defaultAnnotations,
+		},
+		{
+			name:                "with presets",
+			valueFiles:          []string{"../testdata/ingress-presets.yaml"},
+			expectedAnnotations: presetAnnotations,
+		},
+		{
+			name:       "with presets and custom annotations",
+			valueFiles: []string{"../testdata/ingress-presets.yaml"},
+			stringValues: map[string]string{
+				"ingress.annotations.nginx\\.ingress\\.kubernetes\\.io/limit-rps": "50",
+				"ingress.annotations.custom":                                      "annotation",
+			},
+			expectedAnnotations: customizedAnnotations,
+		},
+		{
+			name: "with basic auth from htpasswd",
+			values: map[string]string{
+				"ingress.basicAuth.enabled":  "true",
+				"ingress.basicAuth.htpasswd": "user:$apr1$hash",
+			},
+			expectedAnnotations: basicAuthAnnotations,
+		},
+		{
+			name: "with basic auth from an existing secret",
+			values: map[string]string{
+				"ingress.basicAuth.enabled":    "true",
+				"ingress.basicAuth.secretName": "my-htpasswd",
+				"ingress.basicAuth.realm":      "Staff only",
+			},
+			expectedAnnotations: existingSecretAnnotations,
+		},
+		{
+			name:                "with basic auth and no credentials",
+			values:              map[string]string{"ingress.basicAuth.enabled": "true"},
+			expectedErrorRegexp: regexp.MustCompile("ingress.basicAuth requires either secretName or htpasswd to be set"),
+		},
+		{
+			name:                "with allowlist and no source ranges",
+			values:              map[string]string{"ingress.allowlist.enabled": "true"},
+			expectedErrorRegexp: regexp.MustCompile("ingress.allowlist.sourceRanges is required"),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &helm.Options{
+				ValuesFiles:  tc.valueFiles,
+				SetValues:    tc.values,
+				SetStrValues: tc.stringValues,
+			}
+			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp)
+
+			if tc.expectedErrorRegexp != nil {
+				return
+			}
+
+			ingress := new(extensions.Ingress)
+			helm.UnmarshalK8SYaml(t, output, ingress)
+			require.Equal(t, tc.expectedAnnotations, ingress.ObjectMeta.Annotations)
+		})
+	}
+}
+
 func TestIngressTemplate_DifferentTracks(t *testing.T) {
 	templates := []string{"templates/ingress.yaml"}
 	tcs := []struct {
@@ -157,6 +317,55 @@ func TestIngressTemplate_TLS(t *testing.T) {
 			expectedAnnotations: map[string]string{"kubernetes.io/ingress.class": "nginx"},
 			expectedIngressTLS:  []extensions.IngressTLS(nil),
 		},
+		{
+			name:                "with legacy additional hosts",
+			values:              map[string]string{"service.additionalHosts": "{legacy.example.com,other.example.com}"},
+			expectedAnnotations: map[string]string{"kubernetes.io/ingress.class": "nginx", "kubernetes.io/tls-acme": "true"},
+			expectedIngressTLS: []extensions.IngressTLS{
+				extensions.IngressTLS{
+					Hosts:      []string{"my.host.com", "legacy.example.com", "other.example.com"},
+					SecretName: releaseName + "-auto-deploy-tls",
+				},
+			},
+		},
+		{
+			name: "with mixed legacy and structured additional hosts",
+			values: map[string]string{
+				"service.additionalHosts[0]":               "legacy.example.com",
+				"service.additionalHosts[1].host":          "api.example.com",
+				"service.additionalHosts[1].tlsSecretName": "api-tls",
+				"service.additionalHosts[2].host":          "shared.example.com",
+			},
+			expectedAnnotations: map[string]string{"kubernetes.io/ingress.class": "nginx", "kubernetes.io/tls-acme": "true"},
+			expectedIngressTLS: []extensions.IngressTLS{
+				extensions.IngressTLS{
+					Hosts:      []string{"my.host.com", "legacy.example.com", "shared.example.com"},
+					SecretName: releaseName + "-auto-deploy-tls",
+				},
+				extensions.IngressTLS{
+					Hosts:      []string{"api.example.com"},
+					SecretName: "api-tls",
+				},
+			},
+		},
+		{
+			name: "with structured additional hosts and the default secret",
+			values: map[string]string{
+				"ingress.tls.useDefaultSecret":             "true",
+				"service.additionalHosts[0].host":          "api.example.com",
+				"service.additionalHosts[0].tlsSecretName": "api-tls",
+			},
+			expectedAnnotations: map[string]string{"kubernetes.io/ingress.class": "nginx", "kubernetes.io/tls-acme": "true"},
+			expectedIngressTLS: []extensions.IngressTLS{
+				extensions.IngressTLS{
+					Hosts: []string{"my.host.com"},
+				},
+				extensions.IngressTLS{
+					Hosts:      []string{"api.example.com"},
+					SecretName: "api-tls",
+				},
+			},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -245,7 +454,8 @@ func TestIngressTemplate_HTTPPath(t *testing.T) {
 		name   string
 		values map[string]string
 
-		expectedpath string
+		expectedpath      string
+		expectedHostPaths map[string]string
 	}{
 		{
 			name:         "defaults",
@@ -261,6 +471,34 @@ func TestIngressTemplate_HTTPPath(t *testing.T) {
 			values:       map[string]string{"ingress.path": "/myapi"},
 			expectedpath: "/myapi",
 		},
+		{
+			name: "with legacy additional hosts",
+			values: map[string]string{
+				"ingress.path":            "/myapi",
+				"service.additionalHosts": "{legacy.example.com,other.example.com}",
+			},
+			expectedpath: "/myapi",
+			expectedHostPaths: map[string]string{
+				"legacy.example.com": "/myapi",
+				"other.example.com":  "/myapi",
+			},
+		},
+		{
+			name: "with mixed legacy and structured additional hosts",
+			values: map[string]string{
+				"ingress.path":                    "/myapi",
+				"service.additionalHosts[0]":      "legacy.example.com",
+				"service.additionalHosts[1].host": "api.example.com",
+				"service.additionalHosts[1].path": "/api",
+				"service.additionalHosts[2].host": "default-path.example.com",
+			},
+			expectedpath: "/myapi",
+			expectedHostPaths: map[string]string{
+				"legacy.example.com":       "/myapi",
+				"api.example.com":          "/api",
+				"default-path.example.com": "/myapi",
+			},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -274,10 +512,149 @@ func TestIngressTemplate_HTTPPath(t *testing.T) {
 
 			helm.UnmarshalK8SYaml(t, output, ingress)
 			require.Equal(t, tc.expectedpath, ingress.Spec.Rules[0].IngressRuleValue.HTTP.Paths[0].Path)
+
+			for host, path := range tc.expectedHostPaths {
+				found := false
+				for _, rule := range ingress.Spec.Rules {
+					if rule.Host == host {
+						found = true
+						require.Equal(t, path, rule.IngressRuleValue.HTTP.Paths[0].Path)
+					}
+				}
+				require.Truef(t, found, "expected an ingress rule for host %s", host)
+			}
 		})
 	}
 }
 
+func TestIngressTemplate_ExtraPaths(t *testing.T) {
+	templates := []string{"templates/ingress.yaml"}
+	releaseName := "ingress-extra-paths-test"
+	serviceName := releaseName + "-auto-deploy"
+	prefix := networkingv1.PathTypePrefix
+	exact := networkingv1.PathTypeExact
+	implementationSpecific := networkingv1.PathTypeImplementationSpecific
+	tcs := []struct {
+		name       string
+		values     map[string]string
+		valueFiles []string
+
+		expectedPaths       []networkingv1.HTTPIngressPath
+		expectedErrorRegexp *regexp.Regexp
+	}{
+		{
+			name: "defaults",
+			expectedPaths: []networkingv1.HTTPIngressPath{
+				{Path: "/", PathType: &prefix, Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: serviceName, Port: networkingv1.ServiceBackendPort{Number: 5000}}}},
+			},
+		},
+		{
+			name:   "with ingress.pathType",
+			values: map[string]string{"ingress.path": "/exact", "ingress.pathType": "Exact"},
+			expectedPaths: []networkingv1.HTTPIngressPath{
+				{Path: "/exact", PathType: &exact, Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: serviceName, Port: networkingv1.ServiceBackendPort{Number: 5000}}}},
+			},
+		},
+		{
+			name:       "with extra paths routed to extra ports",
+			valueFiles: []string{"../testdata/ingress-extra-paths.yaml"},
+			expectedPaths: []networkingv1.HTTPIngressPath{
+				{Path: "/", PathType: &prefix, Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: serviceName, Port: networkingv1.ServiceBackendPort{Number: 5000}}}},
+				{Path: "/grpc", PathType: &prefix, Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: serviceName, Port: networkingv1.ServiceBackendPort{Name: "grpc"}}}},
+				{Path: "/admin", PathType: &exact, Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: serviceName, Port: networkingv1.ServiceBackendPort{Name: "admin"}}}},
+				{Path: "/static", PathType: &implementationSpecific, Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: serviceName, Port: networkingv1.ServiceBackendPort{Number: 5000}}}},
+			},
+		},
+		{
+			name: "with extra path routed to the main port name",
+			values: map[string]string{
+				"ingress.extraPaths[0].path":        "/web",
+				"ingress.extraPaths[0].servicePort": "web",
+			},
+			expectedPaths: []networkingv1.HTTPIngressPath{
+				{Path: "/", PathType: &prefix, Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: serviceName, Port: networkingv1.ServiceBackendPort{Number: 5000}}}},
+				{Path: "/web", PathType: &prefix, Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: serviceName, Port: networkingv1.ServiceBackendPort{Name: "web"}}}},
+			},
+		},
+		{
+			name: "with extra path routed to an undefined port",
+			values: map[string]string{
+				"ingress.extraPaths[0].path":        "/grpc",
+				"ingress.extraPaths[0].servicePort": "grpc",
+			},
+			expectedErrorRegexp: regexp.MustCompile(`service port "grpc" for path "/grpc" is not defined in service.extraPorts`),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &helm.Options{
+				ValuesFiles: tc.valueFiles,
+				SetValues:   tc.values,
+			}
+			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp, "--api-versions", "networking.k8s.io/v1/Ingress")
+
+			if tc.expectedErrorRegexp != nil {
+				return
+			}
+
+			ingress := new(networkingv1.Ingress)
+			helm.UnmarshalK8SYaml(t, output, ingress)
+			require.Equal(t, tc.expectedPaths, ingress.Spec.Rules[0].IngressRuleValue.HTTP.Paths)
+		})
+	}
+}
+
+func TestIngressTemplate_AdditionalHostsNetworkingV1(t *testing.T) {
+	templates := []string{"templates/ingress.yaml"}
+	releaseName := "ingress-additional-hosts-v1"
+	opts := &helm.Options{
+		SetValues: map[string]string{
+			"service.additionalHosts[0]":             "legacy.example.com",
+			"service.additionalHosts[1].host":        "api.example.com",
+			"service.additionalHosts[1].path":        "/api",
+			"service.additionalHosts[1].pathType":    "Exact",
+			"service.additionalHosts[1].servicePort": "5001",
+			"service.additionalHosts[2].host":        "grpc.example.com",
+			"service.additionalHosts[2].servicePort": "grpc",
+		},
+	}
+	output := mustRenderTemplate(t, opts, releaseName, templates, nil, "--api-versions", "networking.k8s.io/v1/Ingress")
+	ingress := new(networkingv1.Ingress)
+	helm.UnmarshalK8SYaml(t, output, ingress)
+
+	prefix := networkingv1.PathTypePrefix
+	exact := networkingv1.PathTypeExact
+	serviceName := releaseName + "-auto-deploy"
+	expectedRules := []networkingv1.IngressRule{
+		{
+			Host: "my.host.com",
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{
+				{Path: "/", PathType: &prefix, Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: serviceName, Port: networkingv1.ServiceBackendPort{Number: 5000}}}},
+			}}},
+		},
+		{
+			Host: "legacy.example.com",
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{
+				{Path: "/", PathType: &prefix, Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: serviceName, Port: networkingv1.ServiceBackendPort{Number: 5000}}}},
+			}}},
+		},
+		{
+			Host: "api.example.com",
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{
+				{Path: "/api", PathType: &exact, Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: serviceName, Port: networkingv1.ServiceBackendPort{Number: 5001}}}},
+			}}},
+		},
+		{
+			Host: "grpc.example.com",
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{
+				{Path: "/", PathType: &prefix, Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: serviceName, Port: networkingv1.ServiceBackendPort{Name: "grpc"}}}},
+			}}},
+		},
+	}
+	require.Equal(t, expectedRules, ingress.Spec.Rules)
+}
+
 func TestIngressTemplate_TLSSecret(t *testing.T) {
 	templates := []string{"templates/ingress.yaml"}
 	releaseName := "ingress-secret-name-test"
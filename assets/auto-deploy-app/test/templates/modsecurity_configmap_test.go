@@ -0,0 +1,67 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+	coreV1 "k8s.io/api/core/v1"
+)
+
+func TestModSecurityConfigMapTemplate(t *testing.T) {
+	templates := []string{"templates/modsecurity-configmap.yaml"}
+	releaseName := "modsecurity-configmap-test"
+
+	tcs := []struct {
+		name       string
+		valueFiles []string
+		values     map[string]string
+
+		expectedRules       string
+		expectedErrorRegexp *regexp.Regexp
+	}{
+		{
+			name:                "defaults",
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/modsecurity-configmap.yaml in chart"),
+		},
+		{
+			name:                "with inlined rules",
+			valueFiles:          []string{"../testdata/modsecurity-crs.yaml"},
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/modsecurity-configmap.yaml in chart"),
+		},
+		{
+			name:       "with rules include path",
+			valueFiles: []string{"../testdata/modsecurity-crs.yaml"},
+			values:     map[string]string{"ingress.modSecurity.rulesIncludePath": "/etc/nginx/modsecurity/rules.conf"},
+			expectedRules: `SecRule ARGS:foo "@contains bar" "id:1001,phase:2,deny,msg:'Bar is not allowed'"
+SecRule REQUEST_URI "@beginsWith /admin" "id:1002,phase:1,deny"`,
+		},
+		{
+			name:                "with rules but modSecurity disabled",
+			valueFiles:          []string{"../testdata/modsecurity-crs.yaml"},
+			values:              map[string]string{"ingress.modSecurity.enabled": "false", "ingress.modSecurity.rulesIncludePath": "/etc/nginx/modsecurity/rules.conf"},
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/modsecurity-configmap.yaml in chart"),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &helm.Options{
+				ValuesFiles: tc.valueFiles,
+				SetValues:   tc.values,
+			}
+			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp)
+
+			if tc.expectedErrorRegexp != nil {
+				return
+			}
+
+			configMap := new(coreV1.ConfigMap)
+			helm.UnmarshalK8SYaml(t, output, configMap)
+			require.Equal(t, releaseName+"-auto-deploy-modsecurity", configMap.ObjectMeta.Name)
+			require.Equal(t, tc.expectedRules, strings.TrimSpace(configMap.Data["rules.conf"]))
+		})
+	}
+}
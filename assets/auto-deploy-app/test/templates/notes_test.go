@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+)
+
+// The URLs of NOTES.txt are probed by `auto-deploy verify`, which reads the
+// lines indented by four spaces.
+func TestNotesTemplateURLs(t *testing.T) {
+	releaseName := "notes-test"
+
+	tcs := []struct {
+		name   string
+		values map[string]string
+
+		expectedURLs []string
+	}{
+		{
+			name:         "defaults",
+			values:       map[string]string{"service.url": "http://my.host.com"},
+			expectedURLs: []string{"http://my.host.com/"},
+		},
+		{
+			name: "with common name",
+			values: map[string]string{
+				"service.url":        "http://my.host.com",
+				"service.commonName": "le-1.example.com",
+			},
+			expectedURLs: []string{"http://my.host.com/", "https://le-1.example.com/"},
+		},
+		{
+			name: "with common name without TLS",
+			values: map[string]string{
+				"service.url":         "http://my.host.com",
+				"service.commonName":  "le-1.example.com",
+				"ingress.tls.enabled": "false",
+			},
+			expectedURLs: []string{"http://my.host.com/", "http://le-1.example.com/"},
+		},
+		{
+			name: "with common name and additional hosts",
+			values: map[string]string{
+				"service.url":                     "http://my.host.com",
+				"service.commonName":              "le-1.example.com",
+				"service.additionalHosts[0]":      "legacy.example.com",
+				"service.additionalHosts[1].host": "api.example.com",
+				"service.additionalHosts[1].path": "/api",
+			},
+			expectedURLs: []string{"http://my.host.com/", "https://le-1.example.com/", "https://legacy.example.com/", "https://api.example.com/api"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			args := []string{releaseName, helmChartPath, "--dry-run=client", "--output", "json"}
+			for key, value := range tc.values {
+				args = append(args, "--set", key+"="+value)
+			}
+			output, err := helm.RunHelmCommandAndGetStdOutE(t, &helm.Options{}, "install", args...)
+			require.NoError(t, err)
+
+			var release struct {
+				Info struct {
+					Notes string
+				}
+			}
+			require.NoError(t, json.Unmarshal([]byte(output), &release))
+
+			var urls []string
+			for _, line := range strings.Split(release.Info.Notes, "\n") {
+				if strings.HasPrefix(line, "    ") {
+					urls = append(urls, strings.TrimSpace(line))
+				}
+			}
+			require.Equal(t, tc.expectedURLs, urls)
+		})
+	}
+}
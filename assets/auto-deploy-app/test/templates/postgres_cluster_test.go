@@ -0,0 +1,180 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPostgresClusterTemplate(t *testing.T) {
+	templates := []string{"templates/postgres-cluster.yaml"}
+	releaseName := "postgres-cluster-test"
+
+	tcs := []struct {
+		name   string
+		values map[string]string
+
+		expectedSpec                map[string]interface{}
+		expectedScheduledBackupSpec map[string]interface{}
+		expectedErrorRegexp         *regexp.Regexp
+	}{
+		{
+			name: "defaults",
+			values: map[string]string{
+				"postgresql.managed":         "true",
+				"postgresql.managedProvider": "cloudnativepg",
+			},
+			expectedSpec: map[string]interface{}{
+				"instances": float64(1),
+				"imageName": "ghcr.io/cloudnative-pg/postgresql:16",
+				"bootstrap": map[string]interface{}{
+					"initdb": map[string]interface{}{"database": "app", "owner": "app"},
+				},
+				"storage": map[string]interface{}{"size": "1Gi"},
+			},
+		},
+		{
+			name: "with custom parameters",
+			values: map[string]string{
+				"postgresql.managed":                            "true",
+				"postgresql.managedProvider":                    "cloudnativepg",
+				"postgresql.managedEngineVersion":               "15.4",
+				"postgresql.cloudnativepg.instances":            "3",
+				"postgresql.cloudnativepg.database":             "production",
+				"postgresql.cloudnativepg.owner":                "rails",
+				"postgresql.cloudnativepg.storage.size":         "20Gi",
+				"postgresql.cloudnativepg.storage.storageClass": "ssd",
+			},
+			expectedSpec: map[string]interface{}{
+				"instances": float64(3),
+				"imageName": "ghcr.io/cloudnative-pg/postgresql:15.4",
+				"bootstrap": map[string]interface{}{
+					"initdb": map[string]interface{}{"database": "production", "owner": "rails"},
+				},
+				"storage": map[string]interface{}{"size": "20Gi", "storageClass": "ssd"},
+			},
+		},
+		{
+			name: "with custom image",
+			values: map[string]string{
+				"postgresql.managed":                 "true",
+				"postgresql.managedProvider":         "cloudnativepg",
+				"postgresql.cloudnativepg.imageName": "registry.example.com/postgresql:16-postgis",
+			},
+			expectedSpec: map[string]interface{}{
+				"instances": float64(1),
+				"imageName": "registry.example.com/postgresql:16-postgis",
+				"bootstrap": map[string]interface{}{
+					"initdb": map[string]interface{}{"database": "app", "owner": "app"},
+				},
+				"storage": map[string]interface{}{"size": "1Gi"},
+			},
+		},
+		{
+			name: "with backups",
+			values: map[string]string{
+				"postgresql.managed":                                       "true",
+				"postgresql.managedProvider":                               "cloudnativepg",
+				"postgresql.cloudnativepg.backup.enabled":                  "true",
+				"postgresql.cloudnativepg.backup.schedule":                 "0 30 2 * * *",
+				"postgresql.cloudnativepg.backup.retentionPolicy":          "7d",
+				"postgresql.cloudnativepg.backup.destinationPath":          "s3://backups/production",
+				"postgresql.cloudnativepg.backup.endpointURL":              "https://minio.example.com",
+				"postgresql.cloudnativepg.backup.s3Credentials.secretName": "backup-credentials",
+			},
+			expectedSpec: map[string]interface{}{
+				"instances": float64(1),
+				"imageName": "ghcr.io/cloudnative-pg/postgresql:16",
+				"bootstrap": map[string]interface{}{
+					"initdb": map[string]interface{}{"database": "app", "owner": "app"},
+				},
+				"storage": map[string]interface{}{"size": "1Gi"},
+				"backup": map[string]interface{}{
+					"retentionPolicy": "7d",
+					"barmanObjectStore": map[string]interface{}{
+						"destinationPath": "s3://backups/production",
+						"endpointURL":     "https://minio.example.com",
+						"s3Credentials": map[string]interface{}{
+							"accessKeyId":     map[string]interface{}{"name": "backup-credentials", "key": "ACCESS_KEY_ID"},
+							"secretAccessKey": map[string]interface{}{"name": "backup-credentials", "key": "ACCESS_SECRET_KEY"},
+						},
+					},
+				},
+			},
+			expectedScheduledBackupSpec: map[string]interface{}{
+				"schedule":             "0 30 2 * * *",
+				"backupOwnerReference": "self",
+				"cluster":              map[string]interface{}{"name": releaseName + "-auto-deploy-postgres"},
+			},
+		},
+		{
+			name: "with backups and no destination",
+			values: map[string]string{
+				"postgresql.managed":                      "true",
+				"postgresql.managedProvider":              "cloudnativepg",
+				"postgresql.cloudnativepg.backup.enabled": "true",
+			},
+			expectedErrorRegexp: regexp.MustCompile("postgresql.cloudnativepg.backup.destinationPath is required when backups are enabled"),
+		},
+		{
+			name: "with the cluster of another release",
+			values: map[string]string{
+				"postgresql.managed":                      "true",
+				"postgresql.managedProvider":              "cloudnativepg",
+				"postgresql.cloudnativepg.clusterRelease": "production",
+			},
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/postgres-cluster.yaml in chart"),
+		},
+		{
+			name:                "with crossplane provider",
+			values:              map[string]string{"postgresql.managed": "true"},
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/postgres-cluster.yaml in chart"),
+		},
+		{
+			name: "when disabled",
+			values: map[string]string{
+				"postgresql.managed":         "false",
+				"postgresql.managedProvider": "cloudnativepg",
+			},
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/postgres-cluster.yaml in chart"),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &helm.Options{
+				SetValues: tc.values,
+			}
+			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp)
+			if tc.expectedErrorRegexp != nil {
+				return
+			}
+
+			documents := strings.Split(output, "---")[1:]
+			cluster := new(unstructured.Unstructured)
+			helm.UnmarshalK8SYaml(t, documents[0], &cluster.Object)
+
+			require.Equal(t, "postgresql.cnpg.io/v1", cluster.GetAPIVersion())
+			require.Equal(t, "Cluster", cluster.GetKind())
+			require.Equal(t, releaseName+"-auto-deploy-postgres", cluster.GetName())
+			require.Equal(t, releaseName, cluster.GetLabels()["release"])
+			require.Equal(t, tc.expectedSpec, cluster.Object["spec"])
+
+			if tc.expectedScheduledBackupSpec == nil {
+				require.Len(t, documents, 1)
+				return
+			}
+			require.Len(t, documents, 2)
+			scheduledBackup := new(unstructured.Unstructured)
+			helm.UnmarshalK8SYaml(t, documents[1], &scheduledBackup.Object)
+
+			require.Equal(t, "ScheduledBackup", scheduledBackup.GetKind())
+			require.Equal(t, releaseName+"-auto-deploy-postgres-backup", scheduledBackup.GetName())
+			require.Equal(t, tc.expectedScheduledBackupSpec, scheduledBackup.Object["spec"])
+		})
+	}
+}
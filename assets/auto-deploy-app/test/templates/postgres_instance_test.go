@@ -0,0 +1,104 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPostgresInstanceTemplate(t *testing.T) {
+	templates := []string{"templates/postgres-instance.yaml"}
+	releaseName := "postgres-instance-test"
+
+	tcs := []struct {
+		name   string
+		values map[string]string
+
+		expectedAPIVersion  string
+		expectedKind        string
+		expectedSpec        map[string]interface{}
+		expectedErrorRegexp *regexp.Regexp
+	}{
+		{
+			name:               "defaults",
+			values:             map[string]string{"postgresql.managed": "true"},
+			expectedAPIVersion: "database.crossplane.io/v1alpha1",
+			expectedKind:       "PostgreSQLInstance",
+			expectedSpec: map[string]interface{}{
+				"engineVersion":              "9.6",
+				"writeConnectionSecretToRef": map[string]interface{}{"name": "app-postgres"},
+			},
+		},
+		{
+			name: "with engine version, class selector and secret name",
+			values: map[string]string{
+				"postgresql.managed":                                "true",
+				"postgresql.managedEngineVersion":                   "11",
+				"postgresql.managedSecretName":                      "review-postgres",
+				"postgresql.managedClassSelector.matchLabels.stack": "gitlab",
+			},
+			expectedAPIVersion: "database.crossplane.io/v1alpha1",
+			expectedKind:       "PostgreSQLInstance",
+			expectedSpec: map[string]interface{}{
+				"engineVersion":              "11",
+				"classSelector":              map[string]interface{}{"matchLabels": map[string]interface{}{"stack": "gitlab"}},
+				"writeConnectionSecretToRef": map[string]interface{}{"name": "review-postgres"},
+			},
+		},
+		{
+			name: "with composite resource claim",
+			values: map[string]string{
+				"postgresql.managed":                                   "true",
+				"postgresql.managedEngineVersion":                      "15",
+				"postgresql.managedClassSelector.matchLabels.provider": "aws",
+				"postgresql.crossplane.apiVersion":                     "database.example.org/v1alpha1",
+				"postgresql.crossplane.kind":                           "PostgreSQLInstanceClaim",
+				"postgresql.crossplane.parameters.storageGB":           "20",
+			},
+			expectedAPIVersion: "database.example.org/v1alpha1",
+			expectedKind:       "PostgreSQLInstanceClaim",
+			expectedSpec: map[string]interface{}{
+				"parameters":                 map[string]interface{}{"version": "15", "storageGB": float64(20)},
+				"compositionSelector":        map[string]interface{}{"matchLabels": map[string]interface{}{"provider": "aws"}},
+				"writeConnectionSecretToRef": map[string]interface{}{"name": releaseName + "-auto-deploy-postgres"},
+			},
+		},
+		{
+			name:                "when disabled",
+			values:              map[string]string{"postgresql.managed": "false"},
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/postgres-instance.yaml in chart"),
+		},
+		{
+			name: "with cloudnativepg provider",
+			values: map[string]string{
+				"postgresql.managed":         "true",
+				"postgresql.managedProvider": "cloudnativepg",
+			},
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/postgres-instance.yaml in chart"),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &helm.Options{
+				SetValues: tc.values,
+			}
+			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp)
+			if tc.expectedErrorRegexp != nil {
+				return
+			}
+
+			instance := new(unstructured.Unstructured)
+			helm.UnmarshalK8SYaml(t, output, &instance.Object)
+
+			require.Equal(t, tc.expectedAPIVersion, instance.GetAPIVersion())
+			require.Equal(t, tc.expectedKind, instance.GetKind())
+			require.Equal(t, releaseName, instance.GetName())
+			require.Equal(t, releaseName, instance.GetLabels()["release"])
+			require.Equal(t, tc.expectedSpec, instance.Object["spec"])
+		})
+	}
+}
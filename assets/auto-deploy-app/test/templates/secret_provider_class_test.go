@@ -0,0 +1,77 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSecretProviderClassTemplate(t *testing.T) {
+	templates := []string{"templates/secret-provider-class.yaml"}
+	releaseName := "secret-provider-class-test"
+
+	tcs := []struct {
+		name       string
+		valueFiles []string
+		values     map[string]string
+
+		expectedSecretName  string
+		expectedErrorRegexp *regexp.Regexp
+	}{
+		{
+			name:                "defaults",
+			expectedErrorRegexp: regexp.MustCompile("Error: could not find template templates/secret-provider-class.yaml in chart"),
+		},
+		{
+			name:               "with secret provider class",
+			valueFiles:         []string{"../testdata/synced-secrets.yaml"},
+			expectedSecretName: releaseName + "-auto-deploy-csi",
+		},
+		{
+			name:       "with custom secret name",
+			valueFiles: []string{"../testdata/synced-secrets.yaml"},
+			values: map[string]string{
+				"secretProviderClass.secretName": "my-app-csi",
+			},
+			expectedSecretName: "my-app-csi",
+		},
+		{
+			name: "without provider",
+			values: map[string]string{
+				"secretProviderClass.enabled": "true",
+			},
+			expectedErrorRegexp: regexp.MustCompile("secretProviderClass.provider is required"),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &helm.Options{
+				ValuesFiles: tc.valueFiles,
+				SetValues:   tc.values,
+			}
+			output := mustRenderTemplate(t, opts, releaseName, templates, tc.expectedErrorRegexp)
+
+			if tc.expectedErrorRegexp != nil {
+				return
+			}
+
+			secretProviderClass := new(unstructured.Unstructured)
+			helm.UnmarshalK8SYaml(t, output, &secretProviderClass.Object)
+			require.Equal(t, "SecretProviderClass", secretProviderClass.GetKind())
+			require.Equal(t, releaseName+"-auto-deploy", secretProviderClass.GetName())
+
+			provider, _, err := unstructured.NestedString(secretProviderClass.Object, "spec", "provider")
+			require.NoError(t, err)
+			require.Equal(t, "vault", provider)
+
+			secretObjects, _, err := unstructured.NestedSlice(secretProviderClass.Object, "spec", "secretObjects")
+			require.NoError(t, err)
+			require.Len(t, secretObjects, 1)
+			require.Equal(t, tc.expectedSecretName, secretObjects[0].(map[string]interface{})["secretName"])
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gruntwork-io/terratest/modules/helm"
 	"github.com/stretchr/testify/require"
 	coreV1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
@@ -227,3 +228,30 @@ func TestServiceExtraPortsServiceDefinition(t *testing.T) {
 		})
 	}
 }
+
+func TestServiceExtraPortsIngressExtraPaths(t *testing.T) {
+	releaseName := "service-extra-paths-test"
+	opts := &helm.Options{
+		ValuesFiles: []string{"../testdata/ingress-extra-paths.yaml"},
+	}
+
+	output := mustRenderTemplate(t, opts, releaseName, []string{"templates/service.yaml"}, nil)
+	service := new(coreV1.Service)
+	helm.UnmarshalK8SYaml(t, output, service)
+
+	output = mustRenderTemplate(t, opts, releaseName, []string{"templates/ingress.yaml"}, nil, "--api-versions", "networking.k8s.io/v1/Ingress")
+	ingress := new(networkingv1.Ingress)
+	helm.UnmarshalK8SYaml(t, output, ingress)
+
+	servicePortNames := []string{}
+	for _, port := range service.Spec.Ports {
+		servicePortNames = append(servicePortNames, port.Name)
+	}
+	for _, path := range ingress.Spec.Rules[0].HTTP.Paths {
+		if path.Backend.Service.Port.Name != "" {
+			require.Contains(t, servicePortNames, path.Backend.Service.Port.Name)
+		}
+		require.Equal(t, service.ObjectMeta.Name, path.Backend.Service.Name)
+	}
+}
+
@@ -233,3 +233,15 @@ func tcpReadinessProbe() *coreV1.Probe {
 		TimeoutSeconds:      0,
 	}
 }
+
+func secretKeyEnvVar(name, secretName, key string) coreV1.EnvVar {
+	return coreV1.EnvVar{
+		Name: name,
+		ValueFrom: &coreV1.EnvVarSource{
+			SecretKeyRef: &coreV1.SecretKeySelector{
+				LocalObjectReference: coreV1.LocalObjectReference{Name: secretName},
+				Key:                  key,
+			},
+		},
+	}
+}
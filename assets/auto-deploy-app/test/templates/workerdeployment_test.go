@@ -293,6 +293,28 @@ func TestWorkerDeploymentTemplate(t *testing.T) {
 			ExpectedImagePullPolicy: coreV1.PullIfNotPresent,
 			ExpectedImageRepository: string("root/image/repo:root-tag"),
 		},
+		{
+			CaseName: "worker image digest is defined",
+			Release:  "production",
+			Values: map[string]string{
+				"image.digest":                     "sha256:0123456789abcdef",
+				"workers.worker1.image.repository": "worker1/image/repo",
+				"workers.worker1.image.tag":        "worker1-tag",
+				"workers.worker1.image.digest":     "sha256:fedcba9876543210",
+			},
+			ExpectedImageRepository: string("worker1/image/repo@sha256:fedcba9876543210"),
+		},
+		{
+			CaseName: "root image digest is defined",
+			Release:  "production",
+			Values: map[string]string{
+				"image.repository": "root/image/repo",
+				"image.tag":        "root-tag",
+				"image.digest":     "sha256:0123456789abcdef",
+			},
+			ExpectedImagePullPolicy: coreV1.PullIfNotPresent,
+			ExpectedImageRepository: string("root/image/repo@sha256:0123456789abcdef"),
+		},
 	} {
 		t.Run(tc.CaseName, func(t *testing.T) {
 			namespaceName := "minimal-ruby-app-" + strings.ToLower(random.UniqueId())
@@ -1432,6 +1454,67 @@ func TestWorkerDeploymentTemplate(t *testing.T) {
 				},
 			},
 		},
+		{
+			CaseName: "workers resources presets",
+			Release:  "production",
+			Values: map[string]string{
+				"resourcesPreset":                 "medium",
+				"workers.worker1.command[0]":      "echo",
+				"workers.worker1.command[1]":      "worker1",
+				"workers.worker1.resourcesPreset": "nano",
+				"workers.worker2.command[0]":      "echo",
+				"workers.worker2.command[1]":      "worker2",
+			},
+			ExpectedDeployments: []workerDeploymentTestCase{
+				{
+					ExpectedName: "production-worker1",
+					ExpectedCmd:  []string{"echo", "worker1"},
+					ExpectedResources: coreV1.ResourceRequirements{
+						Limits: coreV1.ResourceList{
+							"memory": resource.MustParse("128Mi"),
+						},
+						Requests: coreV1.ResourceList{
+							"cpu":    resource.MustParse("10m"),
+							"memory": resource.MustParse("64Mi"),
+						},
+					},
+				},
+				{
+					ExpectedName: "production-worker2",
+					ExpectedCmd:  []string{"echo", "worker2"},
+					ExpectedResources: coreV1.ResourceRequirements{
+						Limits: coreV1.ResourceList{
+							"memory": resource.MustParse("1Gi"),
+						},
+						Requests: coreV1.ResourceList{
+							"cpu":    resource.MustParse("250m"),
+							"memory": resource.MustParse("512Mi"),
+						},
+					},
+				},
+			},
+		},
+		{
+			CaseName: "workers resources override worker preset",
+			Release:  "production",
+			Values: map[string]string{
+				"workers.worker1.command[0]":                "echo",
+				"workers.worker1.command[1]":                "worker1",
+				"workers.worker1.resourcesPreset":           "large",
+				"workers.worker1.resources.requests.memory": "250M",
+			},
+			ExpectedDeployments: []workerDeploymentTestCase{
+				{
+					ExpectedName: "production-worker1",
+					ExpectedCmd:  []string{"echo", "worker1"},
+					ExpectedResources: coreV1.ResourceRequirements{
+						Requests: coreV1.ResourceList{
+							"memory": resource.MustParse("250M"),
+						},
+					},
+				},
+			},
+		},
 	} {
 		t.Run(tc.CaseName, func(t *testing.T) {
 			namespaceName := "minimal-ruby-app-" + strings.ToLower(random.UniqueId())
@@ -1711,6 +1794,119 @@ func TestWorkerDeploymentTemplateWithExtraEnvFrom(t *testing.T) {
 	}
 }
 
+func TestWorkerDeploymentTemplateWithSyncedSecrets(t *testing.T) {
+	releaseName := "worker-deployment-with-synced-secrets-test"
+	templates := []string{"templates/worker-deployment.yaml"}
+	readOnly := true
+	expectedEnvFrom := []coreV1.EnvFromSource{
+		{SecretRef: &coreV1.SecretEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: "gitlab-secretname-test"}}},
+		{SecretRef: &coreV1.SecretEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: releaseName + "-auto-deploy-external"}}},
+		{SecretRef: &coreV1.SecretEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: releaseName + "-auto-deploy-csi"}}},
+	}
+	expectedVolume := coreV1.Volume{
+		Name: "secrets-store",
+		VolumeSource: coreV1.VolumeSource{
+			CSI: &coreV1.CSIVolumeSource{
+				Driver:           "secrets-store.csi.k8s.io",
+				ReadOnly:         &readOnly,
+				VolumeAttributes: map[string]string{"secretProviderClass": releaseName + "-auto-deploy"},
+			},
+		},
+	}
+	expectedVolumeMount := coreV1.VolumeMount{Name: "secrets-store", MountPath: "/mnt/secrets-store", ReadOnly: true}
+
+	opts := &helm.Options{
+		ValuesFiles: []string{"../testdata/synced-secrets.yaml"},
+		SetValues: map[string]string{
+			"workers.worker1.command[0]": "echo",
+			"workers.worker1.command[1]": "worker1",
+		},
+	}
+	output := mustRenderTemplate(t, opts, releaseName, templates, nil)
+
+	var deployments deploymentAppsV1List
+	helm.UnmarshalK8SYaml(t, output, &deployments)
+	require.Len(t, deployments.Items, 1)
+	for _, deployment := range deployments.Items {
+		require.Equal(t, releaseName+"-auto-deploy-external,"+releaseName+"-auto-deploy-csi", deployment.ObjectMeta.Annotations["secret.reloader.stakater.com/reload"])
+		require.Equal(t, expectedEnvFrom, deployment.Spec.Template.Spec.Containers[0].EnvFrom)
+		require.Contains(t, deployment.Spec.Template.Spec.Volumes, expectedVolume)
+		require.Contains(t, deployment.Spec.Template.Spec.Containers[0].VolumeMounts, expectedVolumeMount)
+	}
+}
+
+func TestWorkerDeploymentTemplateWithExtraSecrets(t *testing.T) {
+	releaseName := "worker-deployment-with-extra-secrets-test"
+	templates := []string{"templates/worker-deployment.yaml"}
+	expectedEnvFrom := []coreV1.EnvFromSource{
+		{SecretRef: &coreV1.SecretEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: "production-secret"}}},
+		{SecretRef: &coreV1.SecretEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: "production-secret-smtp"}}},
+	}
+	expectedVolumes := []coreV1.Volume{
+		{Name: "extra-secret-0", VolumeSource: coreV1.VolumeSource{Secret: &coreV1.SecretVolumeSource{SecretName: "production-secret-files"}}},
+		{Name: "extra-secret-2", VolumeSource: coreV1.VolumeSource{Secret: &coreV1.SecretVolumeSource{SecretName: "production-secret-tls-api"}}},
+	}
+	expectedVolumeMounts := []coreV1.VolumeMount{
+		{Name: "extra-secret-0", MountPath: "/etc/secrets/files", ReadOnly: true},
+		{Name: "extra-secret-2", MountPath: "/etc/secrets/tls-api", ReadOnly: true},
+	}
+
+	opts := &helm.Options{
+		ValuesFiles: []string{"../testdata/extra-secrets.yaml"},
+		SetValues: map[string]string{
+			"workers.worker1.command[0]": "echo",
+			"workers.worker1.command[1]": "worker1",
+		},
+	}
+	output := mustRenderTemplate(t, opts, releaseName, templates, nil)
+
+	var deployments deploymentAppsV1List
+	helm.UnmarshalK8SYaml(t, output, &deployments)
+	require.Len(t, deployments.Items, 1)
+	for _, deployment := range deployments.Items {
+		require.Equal(t, expectedEnvFrom, deployment.Spec.Template.Spec.Containers[0].EnvFrom)
+		require.Equal(t, expectedVolumes, deployment.Spec.Template.Spec.Volumes)
+		require.Equal(t, expectedVolumeMounts, deployment.Spec.Template.Spec.Containers[0].VolumeMounts)
+	}
+}
+
+func TestWorkerDeploymentTemplateWithConfigMap(t *testing.T) {
+	releaseName := "worker-deployment-with-configmap-test"
+	templates := []string{"templates/worker-deployment.yaml"}
+	expectedEnvFrom := coreV1.EnvFromSource{
+		ConfigMapRef: &coreV1.ConfigMapEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: releaseName + "-auto-deploy-config"}},
+	}
+	expectedVolume := coreV1.Volume{
+		Name: "config-files",
+		VolumeSource: coreV1.VolumeSource{
+			ConfigMap: &coreV1.ConfigMapVolumeSource{LocalObjectReference: coreV1.LocalObjectReference{Name: releaseName + "-auto-deploy-config-files"}},
+		},
+	}
+	expectedVolumeMounts := []coreV1.VolumeMount{
+		{Name: "config-files", MountPath: "/app/config/settings.yaml", SubPath: "0-settings.yaml", ReadOnly: true},
+		{Name: "config-files", MountPath: "/etc/app/settings.yaml", SubPath: "1-settings.yaml", ReadOnly: true},
+	}
+
+	opts := &helm.Options{
+		ValuesFiles: []string{"../testdata/configmap.yaml"},
+		SetValues: map[string]string{
+			"workers.worker1.command[0]": "echo",
+			"workers.worker1.command[1]": "worker1",
+		},
+	}
+	output := mustRenderTemplate(t, opts, releaseName, templates, nil)
+
+	var deployments deploymentAppsV1List
+	helm.UnmarshalK8SYaml(t, output, &deployments)
+	require.Len(t, deployments.Items, 1)
+	for _, deployment := range deployments.Items {
+		require.Regexp(t, "^[0-9a-f]{64}$", deployment.Spec.Template.ObjectMeta.Annotations["checksum/application-config"])
+		require.Equal(t, []coreV1.EnvFromSource{expectedEnvFrom}, deployment.Spec.Template.Spec.Containers[0].EnvFrom)
+		require.Equal(t, []coreV1.Volume{expectedVolume}, deployment.Spec.Template.Spec.Volumes)
+		require.Equal(t, expectedVolumeMounts, deployment.Spec.Template.Spec.Containers[0].VolumeMounts)
+	}
+}
+
 func TestWorkerDeploymentTemplateWithExtraEnv(t *testing.T) {
 	releaseName := "worker-deployment-with-extra-env-test"
 	templates := []string{"templates/worker-deployment.yaml"}
@@ -1824,3 +2020,34 @@ func TestWorkerDeploymentTemplateWithContainerSecurityContext(t *testing.T) {
 		})
 	}
 }
+
+func TestWorkerDeploymentTemplateWithManagedPostgres(t *testing.T) {
+	releaseName := "worker-deployment-managed-postgres-test"
+	templates := []string{"templates/worker-deployment.yaml"}
+	secretName := releaseName + "-auto-deploy-postgres-app"
+	expectedEnv := []coreV1.EnvVar{
+		secretKeyEnvVar("POSTGRES_USER", secretName, "username"),
+		secretKeyEnvVar("POSTGRES_PASSWORD", secretName, "password"),
+		secretKeyEnvVar("POSTGRES_HOST", secretName, "host"),
+		secretKeyEnvVar("POSTGRES_PORT", secretName, "port"),
+		secretKeyEnvVar("POSTGRES_DB", secretName, "dbname"),
+		secretKeyEnvVar("DATABASE_URL", secretName, "uri"),
+	}
+
+	opts := &helm.Options{
+		SetValues: map[string]string{
+			"postgresql.managed":         "true",
+			"postgresql.managedProvider": "cloudnativepg",
+			"workers.worker1.command[0]": "echo",
+			"workers.worker1.command[1]": "worker1",
+		},
+	}
+	output := mustRenderTemplate(t, opts, releaseName, templates, nil)
+
+	var deployments deploymentAppsV1List
+	helm.UnmarshalK8SYaml(t, output, &deployments)
+	require.Len(t, deployments.Items, 1)
+	for _, deployment := range deployments.Items {
+		require.Subset(t, deployment.Spec.Template.Spec.Containers[0].Env, expectedEnv)
+	}
+}
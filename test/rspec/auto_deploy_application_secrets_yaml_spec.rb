@@ -0,0 +1,92 @@
+# frozen_string_literal: true
+
+require 'base64'
+require 'open3'
+require 'tmpdir'
+require 'yaml'
+
+describe 'auto-deploy-application-secrets-yaml' do
+  subject(:secrets) do
+    Dir.mktmpdir do |dir|
+      env = { 'APPLICATION_SECRET_NAME' => 'production-secret' }.merge(variables)
+      if secrets_file
+        File.write(File.join(dir, 'secrets.yaml'), secrets_file)
+        env['APPLICATION_SECRET_FILE'] = File.join(dir, 'secrets.yaml')
+      end
+
+      output, status = Open3.capture2e(env, 'ruby', script, File.join(dir, 'kube-secrets.yaml'))
+      raise output unless status.success?
+
+      YAML.load_stream(File.read(File.join(dir, 'kube-secrets.yaml'))).to_h do |secret|
+        [secret['metadata']['name'], secret['data'].transform_values { |value| Base64.strict_decode64(value) }]
+      end
+    end
+  end
+
+  let(:script) { File.expand_path('../../src/bin/auto-deploy-application-secrets-yaml', __dir__) }
+  let(:variables) { { 'K8S_SECRET_CODE' => '12345' } }
+  let(:secrets_file) { nil }
+
+  it 'creates the application secret from the variables' do
+    expect(secrets).to eq('production-secret' => { 'CODE' => '12345' })
+  end
+
+  context 'with a secrets file' do
+    let(:secrets_file) do
+      <<~YAML
+        API_TOKEN: token-from-file
+        K8S_SECRET_PORT: 5432
+        K8S_TLS_API_CRT: certificate-from-file
+      YAML
+    end
+
+    it 'merges its keys as K8S_SECRET_ variables, unless they start with K8S_' do
+      expect(secrets).to eq(
+        'production-secret' => { 'CODE' => '12345', 'API_TOKEN' => 'token-from-file', 'PORT' => '5432' }
+      )
+    end
+
+    context 'with the secret conventions enabled' do
+      let(:variables) { { 'K8S_SECRET_CODE' => '12345', 'AUTO_DEVOPS_SECRET_CONVENTIONS_ENABLED' => 'true' } }
+
+      it 'creates the secrets of the conventions from its keys' do
+        expect(secrets).to eq(
+          'production-secret' => { 'CODE' => '12345', 'API_TOKEN' => 'token-from-file', 'PORT' => '5432' },
+          'production-secret-tls-api' => { 'tls.crt' => 'certificate-from-file' }
+        )
+      end
+    end
+
+    context 'when a variable sets the same key' do
+      let(:variables) { { 'K8S_SECRET_CODE' => '12345', 'K8S_SECRET_API_TOKEN' => 'token-from-variable' } }
+
+      it 'uses the value of the variable' do
+        expect(secrets['production-secret']['API_TOKEN']).to eq('token-from-variable')
+      end
+    end
+  end
+
+  context 'with an empty secrets file' do
+    let(:secrets_file) { '' }
+
+    it 'only uses the variables' do
+      expect(secrets).to eq('production-secret' => { 'CODE' => '12345' })
+    end
+  end
+
+  context 'with a secrets file that is not a map' do
+    let(:secrets_file) { "- API_TOKEN\n" }
+
+    it 'fails' do
+      expect { secrets }.to raise_error(RuntimeError, /must contain a map of secrets/)
+    end
+  end
+
+  context 'with a nested secret' do
+    let(:secrets_file) { "API:\n  TOKEN: token-from-file\n" }
+
+    it 'fails' do
+      expect { secrets }.to raise_error(RuntimeError, /Secret API .* must not be a map or a list/)
+    end
+  end
+end